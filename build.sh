@@ -1,3 +1,3 @@
-go run cmd/main.go --file ./demofiles/astralis-vs-natus-vincere-m3-inferno.dem
+go run ./cmd --file ./demofiles/astralis-vs-natus-vincere-m3-inferno.dem
 
 # python3 test/test_encode.py
\ No newline at end of file
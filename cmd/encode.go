@@ -0,0 +1,279 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/internal/sim"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+// collectDemos 将命令行参数展开为 demo 文件列表，参数可以是文件、目录或通配符。
+// 多个参数指向同一个文件时只保留一次；不同的 demo 会写入同一个输出目录时返回错误。
+func collectDemos(args []string) ([]string, error) {
+	demos, err := expandDemos(args)
+	if err != nil {
+		return nil, err
+	}
+	var unique []string
+	seen := make(map[string]bool)
+	outputs := make(map[string]string)
+	for _, demo := range demos {
+		abs, err := filepath.Abs(demo)
+		if err != nil {
+			return nil, err
+		}
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		// 输出目录按 demo 名称区分，大小写不敏感的文件系统上只有大小写不同的名称也会冲突
+		name := strings.ToLower(iparser.DemoName(demo))
+		if other, ok := outputs[name]; ok {
+			return nil, fmt.Errorf("%s 与 %s 的输出目录相同, 请分别解析或重命名", other, demo)
+		}
+		outputs[name] = demo
+		unique = append(unique, demo)
+	}
+	return unique, nil
+}
+
+// expandDemos 展开参数中的目录与通配符
+func expandDemos(args []string) ([]string, error) {
+	var demos []string
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, err
+			}
+			demos = append(demos, matches...)
+			continue
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			demos = append(demos, arg)
+			continue
+		}
+		entries, err := ioutil.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".dem") {
+				demos = append(demos, filepath.Join(arg, entry.Name()))
+			}
+		}
+	}
+	return demos, nil
+}
+
+// splitList 拆分逗号分隔的列表并转为小写，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// encodeDemos 使用 jobs 个 worker 并行解析 demo，结果与 demos 顺序一致
+func encodeDemos(demos []string, opts iparser.Options, jobs int) ([]iparser.Result, []error) {
+	results := make([]iparser.Result, len(demos))
+	errs := make([]error, len(demos))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < jobs; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				results[idx], errs[idx] = iparser.Start(demos[idx], opts)
+			}
+		}()
+	}
+	for idx := range demos {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+	return results, errs
+}
+
+// runEncode 处理 encode 子命令: minidemo encode [flags] <demo.dem|dir|glob>...
+func runEncode(args []string) int {
+	opts := iparser.DefaultOptions()
+	var (
+		filePath string
+		rounds   string
+		players  string
+		steamIDs string
+		jobs     int
+
+		keyframes string
+		threshold float64
+
+		fromTick, toTick int
+		from, to         string
+		formatVersion    int
+		export           string
+		timestamp        string
+
+		buttons, noButtons string
+	)
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	fs.StringVar(&filePath, "file", "", "demo file path")
+	fs.StringVar(&opts.OutDir, "out", opts.OutDir, "输出根目录")
+	fs.StringVar(&rounds, "rounds", "", "导出的回合, 例如 3-7,12")
+	fs.StringVar(&players, "players", "", "导出的玩家名, 逗号分隔")
+	fs.StringVar(&steamIDs, "steamids", "", "导出的玩家SteamID64, 逗号分隔")
+	fs.StringVar(&opts.Team, "team", "", "导出的阵营 t|ct")
+	fs.BoolVar(&opts.SkipFreezetime, "skip-freezetime", opts.SkipFreezetime, "从冻结时间结束开始录制")
+	fs.IntVar(&jobs, "jobs", 1, "同时解析的demo数量")
+	fs.StringVar(&keyframes, "keyframes", "fixed", "关键帧策略 fixed|adaptive")
+	fs.Float64Var(&threshold, "keyframe-threshold", 16, "adaptive策略下触发关键帧的偏移距离")
+	fs.IntVar(&fromTick, "from-tick", 0, "只保存该tick之后的帧")
+	fs.IntVar(&toTick, "to-tick", 0, "只保存该tick之前的帧")
+	fs.StringVar(&from, "from", "", "相对回合事件的起点, 例如 first_kill-10s")
+	fs.StringVar(&to, "to", "", "相对回合事件的终点, 例如 bomb_plant+5s")
+	fs.BoolVar(&opts.Stream, "stream", opts.Stream, "流式写出录像以降低内存占用")
+	fs.StringVar(&opts.SpoolDir, "spool-dir", "", "流式写出的临时文件目录, 默认为系统临时目录")
+	fs.StringVar(&timestamp, "timestamp", "wall", "录像时间戳 wall|demo|unix秒数|RFC3339, 使用demo或固定时间时输出可复现")
+	fs.StringVar(&export, "export", "", "同时导出逐帧数据 jsonl,csv")
+	fs.IntVar(&formatVersion, "format-version", 2, fmt.Sprintf("BotMimic格式版本 %v", rec.SupportedVersions()))
+	fs.StringVar(&buttons, "buttons", "", fmt.Sprintf("启用的按键来源, 默认全部 %v", iparser.ButtonSourceNames()))
+	fs.StringVar(&noButtons, "no-buttons", "", "关闭的按键来源, 逗号分隔")
+	fs.BoolVar(&opts.ButtonTrace, "button-trace", false, "将每帧按键的来源写入buttons.jsonl")
+	fs.BoolVar(&opts.Utility, "utility", false, "只导出道具投掷片段")
+	fs.Float64Var(&opts.UtilityLeadTime, "utility-lead", opts.UtilityLeadTime, "道具片段保留投掷前的秒数")
+	fs.Parse(args)
+
+	inputs := fs.Args()
+	if filePath != "" {
+		inputs = append([]string{filePath}, inputs...)
+	}
+	if len(inputs) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: minidemo encode [flags] <demo.dem|dir|glob>...")
+		fs.PrintDefaults()
+		return 2
+	}
+	demos, err := collectDemos(inputs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if len(demos) == 0 {
+		fmt.Fprintln(os.Stderr, "没有找到demo文件")
+		return 2
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(demos) {
+		jobs = len(demos)
+	}
+
+	if opts.Rounds, err = iparser.ParseRounds(rounds); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if opts.SteamIDs, err = iparser.ParseSteamIDs(steamIDs); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	for _, name := range strings.Split(players, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Players = append(opts.Players, name)
+		}
+	}
+	opts.Team = strings.ToLower(opts.Team)
+	if opts.Team != "" && opts.Team != "t" && opts.Team != "ct" {
+		fmt.Fprintf(os.Stderr, "非法的阵营 %q, 只能为 t 或 ct\n", opts.Team)
+		return 2
+	}
+
+	if (fromTick != 0 && from != "") || (toTick != 0 && to != "") {
+		fmt.Fprintln(os.Stderr, "--from-tick/--to-tick 不能与 --from/--to 同时使用")
+		return 2
+	}
+	if fromTick != 0 {
+		opts.From = &iparser.TickBound{Tick: fromTick}
+	} else if opts.From, err = iparser.ParseTickBound(from); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if toTick != 0 {
+		opts.To = &iparser.TickBound{Tick: toTick}
+	} else if opts.To, err = iparser.ParseTickBound(to); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	if _, ok := rec.LookupFormat(int8(formatVersion)); !ok || formatVersion != int(int8(formatVersion)) {
+		fmt.Fprintf(os.Stderr, "不支持的格式版本 %d, 可用版本 %v\n", formatVersion, rec.SupportedVersions())
+		return 2
+	}
+	opts.FormatVersion = int8(formatVersion)
+
+	if opts.Timestamp, err = iparser.ParseTimestampSource(timestamp); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	for _, format := range strings.Split(export, ",") {
+		switch format = strings.ToLower(strings.TrimSpace(format)); format {
+		case "":
+		case iparser.EXPORT_JSONL, iparser.EXPORT_CSV:
+			opts.Export = append(opts.Export, format)
+		default:
+			fmt.Fprintf(os.Stderr, "非法的导出格式 %q, 只能为 jsonl 或 csv\n", format)
+			return 2
+		}
+	}
+
+	if opts.ButtonSources, err = iparser.ResolveButtonSources(splitList(buttons), splitList(noButtons)); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	if opts.UtilityLeadTime < 0 {
+		fmt.Fprintf(os.Stderr, "非法的投掷前时长 %v\n", opts.UtilityLeadTime)
+		return 2
+	}
+
+	switch keyframes {
+	case "fixed":
+		opts.Keyframes = iparser.NewFixedKeyframes
+	case "adaptive":
+		opts.Keyframes = func() iparser.KeyframeStrategy {
+			return sim.NewAdaptiveKeyframes(sim.DefaultConfig(0), threshold)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "非法的关键帧策略 %q, 只能为 fixed 或 adaptive\n", keyframes)
+		return 2
+	}
+
+	results, errs := encodeDemos(demos, opts, jobs)
+
+	exitCode := 0
+	fmt.Printf("共处理 %d 个demo:\n", len(results))
+	for idx, result := range results {
+		fmt.Printf("  %s: %d 个回合, %d 个录像文件 -> %s\n", demos[idx], len(result.Rounds), len(result.Files), result.OutputDir)
+		if errs[idx] != nil {
+			fmt.Fprintf(os.Stderr, "    失败: %s\n", errs[idx].Error())
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+type inspectWeaponChange struct {
+	Tick       int    `json:"tick"`
+	WeaponID   int32  `json:"weapon_id"`
+	WeaponName string `json:"weapon_name"`
+}
+
+type inspectKeyframe struct {
+	Tick     int         `json:"tick"`
+	Origin   *[3]float32 `json:"origin,omitempty"`
+	Angles   *[3]float32 `json:"angles,omitempty"`
+	Velocity *[3]float32 `json:"velocity,omitempty"`
+}
+
+type inspectReport struct {
+	File          string                `json:"file"`
+	Magic         int32                 `json:"magic"`
+	Version       int8                  `json:"version"`
+	Timestamp     int32                 `json:"timestamp"`
+	Name          string                `json:"name"`
+	Position      [3]float32            `json:"position"`
+	Angles        [2]float32            `json:"angles"`
+	TickCount     int                   `json:"tick_count"`
+	Bookmarks     []rec.Bookmark        `json:"bookmarks"`
+	WeaponChanges []inspectWeaponChange `json:"weapon_changes"`
+	Buttons       map[string]int        `json:"buttons"`
+	Keyframes     []inspectKeyframe     `json:"keyframes"`
+}
+
+func newInspectReport(fileName string, r *rec.Recording) *inspectReport {
+	report := &inspectReport{
+		File:          fileName,
+		Magic:         r.Header.Magic,
+		Version:       r.Header.Version,
+		Timestamp:     r.Header.Timestamp,
+		Name:          r.Header.Name,
+		Position:      r.Header.Position,
+		Angles:        r.Header.Angles,
+		TickCount:     len(r.Frames),
+		Bookmarks:     r.Bookmarks,
+		WeaponChanges: []inspectWeaponChange{},
+		Buttons:       make(map[string]int),
+		Keyframes:     []inspectKeyframe{},
+	}
+	if report.Bookmarks == nil {
+		report.Bookmarks = []rec.Bookmark{}
+	}
+	for tick := range r.Frames {
+		frame := &r.Frames[tick]
+		if frame.CSWeaponID != int32(iparser.CSWeapon_NONE) {
+			report.WeaponChanges = append(report.WeaponChanges, inspectWeaponChange{
+				Tick:       tick,
+				WeaponID:   frame.CSWeaponID,
+				WeaponName: iparser.WeaponID2Str(iparser.CSWeaponID(frame.CSWeaponID)),
+			})
+		}
+		for bit := 0; bit < 32; bit++ {
+			if frame.PlayerButtons&(1<<uint(bit)) != 0 {
+				report.Buttons[iparser.ButtonName(bit)]++
+			}
+		}
+		if frame.AdditionalFields != 0 {
+			keyframe := inspectKeyframe{Tick: tick}
+			if frame.AdditionalFields&rec.FIELDS_ORIGIN != 0 {
+				keyframe.Origin = &frame.AtOrigin
+			}
+			if frame.AdditionalFields&rec.FIELDS_ANGLES != 0 {
+				keyframe.Angles = &frame.AtAngles
+			}
+			if frame.AdditionalFields&rec.FIELDS_VELOCITY != 0 {
+				keyframe.Velocity = &frame.AtVelocity
+			}
+			report.Keyframes = append(report.Keyframes, keyframe)
+		}
+	}
+	return report
+}
+
+func (report *inspectReport) print() {
+	fmt.Printf("文件: %s\n", report.File)
+	fmt.Printf("  magic: 0x%08x  version: %d\n", uint32(report.Magic), report.Version)
+	if report.Timestamp == iparser.DEMO_EPOCH {
+		// --timestamp demo 写入的固定值，不是录制时间
+		fmt.Println("  时间: 未记录")
+	} else {
+		fmt.Printf("  时间: %s\n", time.Unix(int64(report.Timestamp), 0).Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("  名称: %s\n", report.Name)
+	fmt.Printf("  setpos %g %g %g; setang %g %g 0\n",
+		report.Position[0], report.Position[1], report.Position[2], report.Angles[0], report.Angles[1])
+	fmt.Printf("  总帧数: %d\n", report.TickCount)
+
+	fmt.Printf("  书签 (%d):\n", len(report.Bookmarks))
+	for _, bookmark := range report.Bookmarks {
+		fmt.Printf("    帧 %-6d %s (teleport %d)\n", bookmark.Frame, bookmark.Name, bookmark.AdditionalTeleportTick)
+	}
+
+	fmt.Printf("  武器切换 (%d):\n", len(report.WeaponChanges))
+	for _, change := range report.WeaponChanges {
+		fmt.Printf("    帧 %-6d %s (%d)\n", change.Tick, change.WeaponName, change.WeaponID)
+	}
+
+	fmt.Printf("  按键统计:\n")
+	for bit := 0; bit < 32; bit++ {
+		name := iparser.ButtonName(bit)
+		if count, ok := report.Buttons[name]; ok {
+			fmt.Printf("    %-14s %d\n", name, count)
+		}
+	}
+
+	fmt.Printf("  关键帧 (%d):\n", len(report.Keyframes))
+	for _, keyframe := range report.Keyframes {
+		fmt.Printf("    帧 %-6d", keyframe.Tick)
+		if keyframe.Origin != nil {
+			fmt.Printf(" origin=%v", *keyframe.Origin)
+		}
+		if keyframe.Angles != nil {
+			fmt.Printf(" angles=%v", *keyframe.Angles)
+		}
+		if keyframe.Velocity != nil {
+			fmt.Printf(" velocity=%v", *keyframe.Velocity)
+		}
+		fmt.Println()
+	}
+}
+
+func inspectFile(fileName string) (*inspectReport, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := rec.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return newInspectReport(fileName, r), nil
+}
+
+// runInspect 处理 inspect 子命令: minidemo inspect [--json] <file.rec>...
+func runInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "用法: minidemo inspect [--json] <file.rec>...")
+		return 2
+	}
+
+	exitCode := 0
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, fileName := range fs.Args() {
+		report, err := inspectFile(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取 %s 失败: %s\n", fileName, err.Error())
+			exitCode = 1
+			continue
+		}
+		if *jsonOutput {
+			encoder.Encode(report)
+		} else {
+			report.print()
+		}
+	}
+	return exitCode
+}
@@ -1,18 +1,42 @@
 package main
 
 import (
-	"flag"
-
-	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"fmt"
+	"os"
 )
 
-func readArgs() string {
-	var filepath string
-	flag.StringVar(&filepath, "file", "", "demo file path")
-	flag.Parse()
-	return filepath
+func usage() {
+	fmt.Fprintln(os.Stderr, `用法: minidemo <command> [arguments]
+
+命令:
+  encode   解析demo并生成录像文件
+  inspect  查看录像文件内容
+  simulate 离线模拟回放并统计位置偏移
+  slice    截取录像文件的一段
+  validate 检查录像文件能否被BotMimic正确读取
+
+不带命令时等同于 encode, 例如: minidemo -file {demo_path}`)
 }
 
 func main() {
-	iparser.Start(readArgs())
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "encode":
+		os.Exit(runEncode(os.Args[2:]))
+	case "inspect":
+		os.Exit(runInspect(os.Args[2:]))
+	case "simulate":
+		os.Exit(runSimulate(os.Args[2:]))
+	case "slice":
+		os.Exit(runSlice(os.Args[2:]))
+	case "validate":
+		os.Exit(runValidate(os.Args[2:]))
+	case "help", "-h", "--help":
+		usage()
+	default:
+		os.Exit(runEncode(os.Args[1:]))
+	}
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dxldb/minidemo-encoder/internal/sim"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+func simulateFile(fileName string, cfg sim.Config) (*sim.Report, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := rec.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	// v1 的帧没有 Origin，无法与模拟的位置比较
+	if r.Header.Version == 1 {
+		return nil, errors.New("v1 录像没有每一帧的位置, 无法统计偏移, 请使用 --format-version 2 重新生成")
+	}
+	return sim.Simulate(r, cfg), nil
+}
+
+// runSimulate 处理 simulate 子命令: minidemo simulate [--tickrate N] [--json] <file.rec>...
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	tickrate := fs.Float64("tickrate", 64, "录像的tickrate")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出每一帧的偏移")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || *tickrate <= 0 {
+		fmt.Fprintln(os.Stderr, "用法: minidemo simulate [--tickrate N] [--json] <file.rec>...")
+		return 2
+	}
+
+	exitCode := 0
+	cfg := sim.DefaultConfig(*tickrate)
+	encoder := json.NewEncoder(os.Stdout)
+	for _, fileName := range fs.Args() {
+		report, err := simulateFile(fileName, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取 %s 失败: %s\n", fileName, err.Error())
+			exitCode = 1
+			continue
+		}
+		if *jsonOutput {
+			encoder.Encode(report)
+			continue
+		}
+		fmt.Printf("%s: %d 帧, 最大偏移 %.2f (帧 %d), 平均 %.2f, RMS %.2f, 结束时 %.2f\n",
+			fileName, len(report.Ticks), report.MaxError, report.MaxErrorTick,
+			report.MeanError, report.RMSError, report.FinalError)
+	}
+	return exitCode
+}
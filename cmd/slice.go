@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+// bookmarkEvents 返回每个书签第一次出现的帧，"kill s1mple" 同时以 "kill" 登记
+func bookmarkEvents(r *rec.Recording) map[string]int {
+	events := make(map[string]int)
+	for _, bookmark := range r.Bookmarks {
+		names := []string{bookmark.Name}
+		if idx := strings.IndexByte(bookmark.Name, ' '); idx > 0 {
+			names = append(names, bookmark.Name[:idx])
+		}
+		for _, name := range names {
+			if _, ok := events[name]; !ok {
+				events[name] = int(bookmark.Frame)
+			}
+		}
+	}
+	return events
+}
+
+// sliceFile 截取 [from, to] 帧写入 outFile，返回写出的帧数
+func sliceFile(inFile, outFile string, from, to *iparser.TickBound, tickrate float64) (int, error) {
+	file, err := os.Open(inFile)
+	if err != nil {
+		return 0, err
+	}
+	r, err := rec.Decode(file)
+	file.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	events := bookmarkEvents(r)
+	start, end := 0, len(r.Frames)
+	if from != nil {
+		frame, ok := from.Resolve(events, tickrate)
+		if !ok {
+			return 0, fmt.Errorf("录像中没有书签 %q", from.Event)
+		}
+		start = frame
+	}
+	if to != nil {
+		frame, ok := to.Resolve(events, tickrate)
+		if !ok {
+			return 0, fmt.Errorf("录像中没有书签 %q", to.Event)
+		}
+		end = frame + 1
+	}
+	clip := r.Slice(start, end)
+	if len(clip.Frames) == 0 {
+		return 0, fmt.Errorf("切片范围 [%d, %d) 内没有帧", start, end)
+	}
+	return len(clip.Frames), clip.WriteFile(outFile)
+}
+
+// runSlice 处理 slice 子命令: minidemo slice [--from X] [--to Y] [--tickrate N] [-o out.rec] <file.rec>
+func runSlice(args []string) int {
+	fs := flag.NewFlagSet("slice", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "起始帧, 或相对书签的时间, 例如 first_shot-2s")
+	toFlag := fs.String("to", "", "结束帧(包含), 或相对书签的时间, 例如 death+1s")
+	tickrate := fs.Float64("tickrate", 64, "录像的tickrate, 用于换算时间偏移")
+	outFile := fs.String("o", "", "输出文件, 默认为 <name>_slice.rec")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *tickrate <= 0 {
+		fmt.Fprintln(os.Stderr, "用法: minidemo slice [--from X] [--to Y] [--tickrate N] [-o out.rec] <file.rec>")
+		return 2
+	}
+	from, err := iparser.ParseTickBound(*fromFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	to, err := iparser.ParseTickBound(*toFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	inFile := fs.Arg(0)
+	if *outFile == "" {
+		*outFile = strings.TrimSuffix(inFile, filepath.Ext(inFile)) + "_slice.rec"
+	}
+	frames, err := sliceFile(inFile, *outFile, from, to, *tickrate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "切片 %s 失败: %s\n", inFile, err.Error())
+		return 1
+	}
+	fmt.Printf("%s -> %s: %d 帧\n", inFile, *outFile, frames)
+	return 0
+}
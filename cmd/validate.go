@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+// collectRecs 将命令行参数展开为 .rec 文件列表，目录会递归查找
+func collectRecs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".rec") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func validateFile(fileName string, opts rec.ValidateOptions) (*rec.ValidationReport, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	report := rec.Validate(data, opts)
+	report.File = fileName
+	return report, nil
+}
+
+func printValidation(report *rec.ValidationReport) {
+	status := "OK"
+	if !report.Valid {
+		status = "FAIL"
+	}
+	fmt.Printf("%-4s %s (%d 帧)\n", status, report.File, report.TickCount)
+	for _, issue := range report.Issues {
+		frame := ""
+		if issue.Frame != nil {
+			frame = fmt.Sprintf(" 帧 %d:", *issue.Frame)
+		}
+		fmt.Printf("     [%s] %s%s %s\n", issue.Severity, issue.Check, frame, issue.Message)
+	}
+	shown := make(map[string]int)
+	for _, issue := range report.Issues {
+		shown[issue.Check]++
+	}
+	checks := make([]string, 0, len(report.Counts))
+	for check := range report.Counts {
+		checks = append(checks, check)
+	}
+	sort.Strings(checks)
+	for _, check := range checks {
+		if hidden := report.Counts[check] - shown[check]; hidden > 0 {
+			fmt.Printf("     %s: 另有 %d 个问题未列出\n", check, hidden)
+		}
+	}
+}
+
+// runValidate 处理 validate 子命令: minidemo validate [--tickrate N] [--json] <file.rec|dir>...
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	tickrate := fs.Float64("tickrate", 64, "录像的tickrate, 用于检查传送式位移")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "用法: minidemo validate [--tickrate N] [--json] <file.rec|dir>...")
+		return 2
+	}
+	files, err := collectRecs(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	opts := rec.ValidateOptions{
+		TickRate: *tickrate,
+		ValidWeapon: func(weaponID int32) bool {
+			return iparser.IsValidWeaponID(iparser.CSWeaponID(weaponID))
+		},
+	}
+	exitCode := 0
+	reports := []*rec.ValidationReport{}
+	for _, fileName := range files {
+		report, err := validateFile(fileName, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取 %s 失败: %s\n", fileName, err.Error())
+			exitCode = 1
+			continue
+		}
+		if !report.Valid {
+			exitCode = 1
+		}
+		if *jsonOutput {
+			reports = append(reports, report)
+		} else {
+			printValidation(report)
+		}
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(reports)
+	}
+	return exitCode
+}
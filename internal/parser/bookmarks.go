@@ -0,0 +1,53 @@
+package parser
+
+import (
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// 书签名称
+const (
+	BOOKMARK_FREEZETIME_END = "freezetime_end"
+	BOOKMARK_FIRST_SHOT     = "first_shot"
+	BOOKMARK_KILL           = "kill"
+	BOOKMARK_DEATH          = "death"
+	BOOKMARK_BOMB_PLANT     = "bomb_plant"
+	BOOKMARK_BOMB_DEFUSE    = "bomb_defuse"
+	BOOKMARK_THROW          = "throw"
+)
+
+// addBookmark 在玩家即将录制的帧上添加书签，玩家没有在录制时忽略。
+// 回合结束前没有录制的帧上的书签在保存时移到最后一帧。
+func (s *demoState) addBookmark(player *common.Player, name string) {
+	if player == nil {
+		return
+	}
+	recording := s.enc.Recording(playerKey(player))
+	if recording == nil {
+		return
+	}
+	recording.AddBookmark(int32(recording.FrameCount()), name)
+}
+
+// addDeathBookmark 死亡的玩家不会再录制新的帧，书签放在最后一帧 (finishPlayer 追加的帧) 上
+func (s *demoState) addDeathBookmark(player *common.Player) {
+	if player == nil {
+		return
+	}
+	recording := s.enc.Recording(playerKey(player))
+	if recording == nil || len(recording.Frames) == 0 {
+		return
+	}
+	recording.AddBookmark(int32(recording.FrameCount()-1), BOOKMARK_DEATH)
+}
+
+// addFirstShotBookmark 每段录像只标记第一次开火
+func (s *demoState) addFirstShotBookmark(player *common.Player) {
+	if player == nil || s.playerFired[playerKey(player)] {
+		return
+	}
+	if s.enc.Recording(playerKey(player)) == nil {
+		return
+	}
+	s.playerFired[playerKey(player)] = true
+	s.addBookmark(player, BOOKMARK_FIRST_SHOT)
+}
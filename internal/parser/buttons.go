@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+
 	// ilog "github.com/hx-w/minidemo-encoder/internal/logger"
 	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 )
@@ -34,16 +36,45 @@ const (
 	IN_ATTACK3         = (1 << 25)
 )
 
-func ButtonConvert(player *common.Player, addonButton int32) int32 {
-	var button int32 = addonButton
-	if player.Flags().DuckingKeyPressed() {
-		button |= IN_DUCK
+var buttonNames = [...]string{
+	"IN_ATTACK", "IN_JUMP", "IN_DUCK", "IN_FORWARD", "IN_BACK", "IN_USE", "IN_CANCEL",
+	"IN_LEFT", "IN_RIGHT", "IN_MOVELEFT", "IN_MOVERIGHT", "IN_ATTACK2", "IN_RUN",
+	"IN_RELOAD", "IN_ALT1", "IN_ALT2", "IN_SCORE", "IN_SPEED", "IN_WALK", "IN_ZOOM",
+	"IN_WEAPON1", "IN_WEAPON2", "IN_BULLRUSH", "IN_GRENADE1", "IN_GRENADE2", "IN_ATTACK3",
+}
+
+// ButtonCount 已定义的按键位数量
+const ButtonCount = len(buttonNames)
+
+// ButtonName 返回第 bit 位按键的名称
+func ButtonName(bit int) string {
+	if bit < 0 || bit >= ButtonCount {
+		return fmt.Sprintf("IN_UNKNOWN%d", bit)
+	}
+	return buttonNames[bit]
+}
+
+// grenadeButtons 拉开保险时按住的投掷键。
+// m_flThrowStrength 为 1 时是左键投掷，0 时是右键低抛，0.5 时是左右键同时按下，
+// 松开按键的那一帧道具被投出。
+func grenadeButtons(player *common.Player) int32 {
+	weapon := player.ActiveWeapon()
+	if weapon == nil || weapon.Entity == nil || weapon.Class() != common.EqClassGrenade {
+		return 0
+	}
+	pinPulled, ok := weapon.Entity.PropertyValue("m_bPinPulled")
+	if !ok || !pinPulled.BoolVal() {
+		return 0
+	}
+	strength, ok := weapon.Entity.PropertyValue("m_flThrowStrength")
+	if !ok {
+		return IN_ATTACK
 	}
-	if player.IsWalking() {
-		button |= IN_SPEED
+	switch {
+	case strength.FloatVal > 0.75:
+		return IN_ATTACK
+	case strength.FloatVal < 0.25:
+		return IN_ATTACK2
 	}
-	if player.IsReloading {
-		button |= IN_RELOAD
-	}	
-	return button
+	return IN_ATTACK | IN_ATTACK2
 }
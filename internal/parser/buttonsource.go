@@ -0,0 +1,391 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// 内置的按键来源
+const (
+	BUTTON_SOURCE_FIRE    = "fire"
+	BUTTON_SOURCE_JUMP    = "jump"
+	BUTTON_SOURCE_SCOPE   = "scope"
+	BUTTON_SOURCE_DUCK    = "duck"
+	BUTTON_SOURCE_WALK    = "walk"
+	BUTTON_SOURCE_RELOAD  = "reload"
+	BUTTON_SOURCE_GRENADE = "grenade"
+	// 以下来源读取玩家实体的属性，见 propsource.go
+	BUTTON_SOURCE_USE      = "use"
+	BUTTON_SOURCE_SPRAY    = "spray"
+	BUTTON_SOURCE_AIRBORNE = "airborne"
+	BUTTON_SOURCE_LADDER   = "ladder"
+	// 根据下一帧的速度变化推断移动键，见 movement.go
+	BUTTON_SOURCE_MOVEMENT = "movement"
+)
+
+const buttonTraceFileName = "buttons.jsonl"
+
+// ButtonSource 为每个玩家每帧提供一部分按键位，所有启用的来源按位或得到该帧的按键。
+// 每个 demo 使用单独的实例，可以在内部保存状态。
+// 移动键 (IN_FORWARD 等) 通常由 movement 来源 (inferMovement) 根据速度变化在下一帧补上；
+// 其他来源给出了移动键时 (例如梯子上) 不再推断。
+type ButtonSource interface {
+	// Register 在解析开始前调用，根据事件判断按键的来源在此注册事件处理
+	Register(parser dem.Parser)
+	// Buttons 返回玩家在 tick 时按下的按键，只对正在录制的存活玩家调用
+	Buttons(player *common.Player, tick int) int32
+	// Reset 在新回合开始时调用
+	Reset()
+}
+
+// ButtonSourceFactory 为每个 demo 创建按键来源
+type ButtonSourceFactory func() ButtonSource
+
+var (
+	buttonSources     = make(map[string]ButtonSourceFactory)
+	buttonSourceOrder []string
+)
+
+// RegisterButtonSource 注册按键来源，同名来源重复注册时覆盖之前的实现
+func RegisterButtonSource(name string, factory ButtonSourceFactory) {
+	if _, ok := buttonSources[name]; !ok {
+		buttonSourceOrder = append(buttonSourceOrder, name)
+	}
+	buttonSources[name] = factory
+}
+
+// ButtonSourceNames 返回所有已注册的按键来源，按注册顺序排列
+func ButtonSourceNames() []string {
+	return append([]string(nil), buttonSourceOrder...)
+}
+
+// ResolveButtonSources 返回启用的按键来源：enable 为空时为全部来源，再去掉 disable 中的来源
+func ResolveButtonSources(enable, disable []string) ([]string, error) {
+	for _, name := range append(append([]string(nil), enable...), disable...) {
+		if _, ok := buttonSources[name]; !ok {
+			return nil, fmt.Errorf("未知的按键来源 %q, 可用来源 %v", name, ButtonSourceNames())
+		}
+	}
+	if len(enable) == 0 {
+		enable = ButtonSourceNames()
+	}
+	names := []string{}
+	for _, name := range enable {
+		if !containsString(disable, name) && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterButtonSource(BUTTON_SOURCE_FIRE, func() ButtonSource { return &fireSource{} })
+	RegisterButtonSource(BUTTON_SOURCE_JUMP, func() ButtonSource { return &jumpSource{} })
+	RegisterButtonSource(BUTTON_SOURCE_SCOPE, func() ButtonSource { return &scopeSource{} })
+	RegisterButtonSource(BUTTON_SOURCE_DUCK, newDuckSource)
+	RegisterButtonSource(BUTTON_SOURCE_WALK, playerButtons(func(player *common.Player) int32 {
+		if player.IsWalking() {
+			return IN_SPEED
+		}
+		return 0
+	}))
+	RegisterButtonSource(BUTTON_SOURCE_RELOAD, playerButtons(func(player *common.Player) int32 {
+		if player.IsReloading {
+			return IN_RELOAD
+		}
+		return 0
+	}))
+	RegisterButtonSource(BUTTON_SOURCE_GRENADE, playerButtons(grenadeButtons))
+	RegisterButtonSource(BUTTON_SOURCE_USE, newUseSource)
+	RegisterButtonSource(BUTTON_SOURCE_SPRAY, newSpraySource)
+	RegisterButtonSource(BUTTON_SOURCE_AIRBORNE, newAirborneSource)
+	RegisterButtonSource(BUTTON_SOURCE_LADDER, newLadderSource)
+	RegisterButtonSource(BUTTON_SOURCE_MOVEMENT, func() ButtonSource { return movementSource{} })
+}
+
+// movementSource 当前帧不给出按键，移动键在下一帧由 inferMovement 推断后写入，
+// 禁用该来源时不推断移动键
+type movementSource struct{}
+
+func (movementSource) Register(parser dem.Parser) {}
+
+func (movementSource) Buttons(player *common.Player, tick int) int32 {
+	return 0
+}
+
+func (movementSource) Reset() {}
+
+// stateSource 只根据玩家当前的状态判断按键
+type stateSource func(player *common.Player) int32
+
+func (stateSource) Register(parser dem.Parser) {}
+
+func (fn stateSource) Buttons(player *common.Player, tick int) int32 {
+	return fn(player)
+}
+
+func (stateSource) Reset() {}
+
+// playerButtons 返回只根据玩家当前状态判断按键的来源
+func playerButtons(fn func(player *common.Player) int32) ButtonSourceFactory {
+	return func() ButtonSource { return stateSource(fn) }
+}
+
+type tickButtons struct {
+	tick    int
+	buttons int32
+}
+
+// pressSource 在事件发生的 tick 按下按键，事件在同一 tick 的 FrameDone 之前分发
+type pressSource struct {
+	pressed map[uint64]tickButtons
+}
+
+func (s *pressSource) press(player *common.Player, tick int, buttons int32) {
+	if player == nil {
+		return
+	}
+	if s.pressed == nil {
+		s.pressed = make(map[uint64]tickButtons)
+	}
+	key := playerKey(player)
+	if last, ok := s.pressed[key]; ok && last.tick == tick {
+		buttons |= last.buttons
+	}
+	s.pressed[key] = tickButtons{tick: tick, buttons: buttons}
+}
+
+func (s *pressSource) Buttons(player *common.Player, tick int) int32 {
+	key := playerKey(player)
+	last, ok := s.pressed[key]
+	if !ok || last.tick != tick {
+		return 0
+	}
+	delete(s.pressed, key)
+	return last.buttons
+}
+
+func (s *pressSource) Reset() {
+	s.pressed = nil
+}
+
+// jumpSource 起跳的 tick 按下 IN_JUMP
+type jumpSource struct {
+	pressSource
+}
+
+func (s *jumpSource) Register(parser dem.Parser) {
+	parser.RegisterEventHandler(func(e events.PlayerJump) {
+		gs := parser.GameState()
+		if gs.IsWarmupPeriod() {
+			return
+		}
+		s.press(e.Player, gs.IngameTick(), IN_JUMP)
+	})
+}
+
+// scopeSource 开镜状态改变的一帧按下 IN_ATTACK2
+type scopeSource struct {
+	lastScoped map[uint64]bool
+}
+
+func (s *scopeSource) Register(parser dem.Parser) {}
+
+func (s *scopeSource) Buttons(player *common.Player, tick int) int32 {
+	if s.lastScoped == nil {
+		s.lastScoped = make(map[uint64]bool)
+	}
+	key := playerKey(player)
+	currentScoped := player.IsScoped()
+	lastScoped, exists := s.lastScoped[key]
+	s.lastScoped[key] = currentScoped
+	if exists && currentScoped != lastScoped {
+		return IN_ATTACK2
+	}
+	return 0
+}
+
+func (s *scopeSource) Reset() {
+	s.lastScoped = nil
+}
+
+// ButtonTraceRow 记录一帧中每个按键由哪些来源按下
+type ButtonTraceRow struct {
+	Tick    int                 `json:"tick"`
+	SteamID uint64              `json:"steamid,string"`
+	Name    string              `json:"name"`
+	Buttons int32               `json:"buttons"`
+	Sources map[string][]string `json:"sources"`
+}
+
+// buttonPipeline 按顺序汇总启用的按键来源
+type buttonPipeline struct {
+	names   []string
+	sources []ButtonSource
+	// 是否启用 movement 来源
+	movement bool
+
+	// 调试记录，为空时不记录
+	traceFile *os.File
+	traceBuf  *bufio.Writer
+	trace     *json.Encoder
+	traceErr  error
+	// 移动键要到下一帧才能确定：collected 为刚汇总的一帧，pending 为每个玩家等待移动键的上一帧
+	collected *ButtonTraceRow
+	pending   map[uint64]*ButtonTraceRow
+}
+
+// newButtonPipeline 创建按键来源，names 为 nil 时启用全部来源
+func newButtonPipeline(names []string) (*buttonPipeline, error) {
+	if names == nil {
+		names = ButtonSourceNames()
+	}
+	p := &buttonPipeline{}
+	for _, name := range names {
+		factory, ok := buttonSources[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的按键来源 %q, 可用来源 %v", name, ButtonSourceNames())
+		}
+		p.names = append(p.names, name)
+		p.sources = append(p.sources, factory())
+		if name == BUTTON_SOURCE_MOVEMENT {
+			p.movement = true
+		}
+	}
+	return p, nil
+}
+
+// openTrace 将每帧按键的来源写入 <dir>/buttons.jsonl
+func (p *buttonPipeline) openTrace(dir string) error {
+	file, err := os.Create(filepath.Join(dir, buttonTraceFileName))
+	if err != nil {
+		return err
+	}
+	p.traceFile = file
+	p.traceBuf = bufio.NewWriter(file)
+	p.trace = json.NewEncoder(p.traceBuf)
+	p.pending = make(map[uint64]*ButtonTraceRow)
+	return nil
+}
+
+func (p *buttonPipeline) register(parser dem.Parser) {
+	for _, source := range p.sources {
+		source.Register(parser)
+	}
+}
+
+func (p *buttonPipeline) reset() {
+	p.flushPending()
+	for _, source := range p.sources {
+		source.Reset()
+	}
+}
+
+// collect 返回玩家在 tick 时所有来源按下的按键。
+// 记录调试信息时，该帧的来源在 settle 中暂存，等下一帧推断出移动键后写出。
+func (p *buttonPipeline) collect(player *common.Player, tick int) int32 {
+	var buttons int32
+	sources := make(map[string][]string)
+	for idx, source := range p.sources {
+		bits := source.Buttons(player, tick)
+		buttons |= bits
+		if p.trace != nil {
+			addButtonSource(sources, bits, p.names[idx])
+		}
+	}
+	if p.trace != nil {
+		p.collected = &ButtonTraceRow{
+			Tick:    tick,
+			SteamID: player.SteamID64,
+			Name:    player.Name,
+			Buttons: buttons,
+			Sources: sources,
+		}
+	}
+	return buttons
+}
+
+// settle 在上一帧 last 的移动键确定之后调用，inferred 为推断出的移动键。
+// 写出上一帧的记录，并暂存 collect 刚汇总的一帧；last 为空时上一帧的记录按原样写出。
+func (p *buttonPipeline) settle(player *common.Player, last *rec.FrameInfo, inferred int32) {
+	if p.trace == nil {
+		return
+	}
+	key := playerKey(player)
+	if row := p.pending[key]; row != nil {
+		if last != nil {
+			row.Buttons = last.PlayerButtons
+			addButtonSource(row.Sources, inferred, BUTTON_SOURCE_MOVEMENT)
+		}
+		p.writeRow(row)
+	}
+	p.pending[key] = p.collected
+	p.collected = nil
+}
+
+// flushPending 按玩家顺序写出所有等待移动键的记录，这些帧之后没有下一帧，不再推断
+func (p *buttonPipeline) flushPending() {
+	keys := make([]uint64, 0, len(p.pending))
+	for key := range p.pending {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, key := range keys {
+		if row := p.pending[key]; row != nil {
+			p.writeRow(row)
+		}
+		delete(p.pending, key)
+	}
+}
+
+func (p *buttonPipeline) writeRow(row *ButtonTraceRow) {
+	if len(row.Sources) == 0 || p.traceErr != nil {
+		return
+	}
+	p.traceErr = p.trace.Encode(row)
+}
+
+// addButtonSource 将 bits 中的每个按键记为由 name 按下
+func addButtonSource(sources map[string][]string, bits int32, name string) {
+	for bit := 0; bit < 32; bit++ {
+		if bits&(1<<bit) != 0 {
+			sources[ButtonName(bit)] = append(sources[ButtonName(bit)], name)
+		}
+	}
+}
+
+// close 关闭调试记录并返回写出时的第一个错误，可以重复调用
+func (p *buttonPipeline) close() error {
+	if p.traceFile == nil {
+		return nil
+	}
+	p.flushPending()
+	err := p.traceErr
+	if flushErr := p.traceBuf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := p.traceFile.Close(); err == nil {
+		err = closeErr
+	}
+	p.traceFile = nil
+	p.trace = nil
+	return err
+}
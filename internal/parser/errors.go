@@ -0,0 +1,17 @@
+package parser
+
+import "fmt"
+
+// DemoError 解析 Demo 的某一步失败
+type DemoError struct {
+	Demo string
+	// 失败的步骤: "open", "mkdir", "timestamp", "format", "export", "buttons", "parse" 或 "write"
+	Op  string
+	Err error
+}
+
+func (e *DemoError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Op, e.Demo, e.Err.Error())
+}
+
+func (e *DemoError) Unwrap() error { return e.Err }
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// 表格导出格式
+const (
+	EXPORT_JSONL = "jsonl"
+	EXPORT_CSV   = "csv"
+)
+
+// TickRow 单个玩家在一帧的数据
+type TickRow struct {
+	Tick     int        `json:"tick"`
+	Round    int        `json:"round"`
+	SteamID  uint64     `json:"steamid,string"`
+	Name     string     `json:"name"`
+	Team     string     `json:"team"`
+	Origin   [3]float32 `json:"origin"`
+	Velocity [3]float32 `json:"velocity"`
+	// pitch, yaw
+	Angles   [2]float32 `json:"angles"`
+	Buttons  int32      `json:"buttons"`
+	WeaponID int32      `json:"weapon_id"`
+	Weapon   string     `json:"weapon"`
+	Health   int        `json:"health"`
+	Armor    int        `json:"armor"`
+	Money    int        `json:"money"`
+}
+
+// TickWriter 逐行写出 TickRow
+type TickWriter interface {
+	WriteRow(row *TickRow) error
+	// Close 写出缓冲的数据并关闭文件
+	Close() error
+}
+
+type jsonLinesWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+}
+
+func (w *jsonLinesWriter) WriteRow(row *TickRow) error {
+	return w.enc.Encode(row)
+}
+
+func (w *jsonLinesWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+var csvHeader = []string{
+	"tick", "round", "steamid", "name", "team",
+	"x", "y", "z", "vx", "vy", "vz", "pitch", "yaw",
+	"buttons", "weapon_id", "weapon", "health", "armor", "money",
+}
+
+type csvWriter struct {
+	file   *os.File
+	w      *csv.Writer
+	record []string
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+func (w *csvWriter) WriteRow(row *TickRow) error {
+	w.record = append(w.record[:0],
+		strconv.Itoa(row.Tick), strconv.Itoa(row.Round), strconv.FormatUint(row.SteamID, 10), row.Name, row.Team,
+		formatFloat(row.Origin[0]), formatFloat(row.Origin[1]), formatFloat(row.Origin[2]),
+		formatFloat(row.Velocity[0]), formatFloat(row.Velocity[1]), formatFloat(row.Velocity[2]),
+		formatFloat(row.Angles[0]), formatFloat(row.Angles[1]),
+		strconv.Itoa(int(row.Buttons)), strconv.Itoa(int(row.WeaponID)), row.Weapon,
+		strconv.Itoa(row.Health), strconv.Itoa(row.Armor), strconv.Itoa(row.Money),
+	)
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// NewTickWriter 在 dir 下创建 ticks.<format> 并返回对应格式的 TickWriter
+func NewTickWriter(dir, format string) (TickWriter, error) {
+	if format != EXPORT_JSONL && format != EXPORT_CSV {
+		return nil, fmt.Errorf("不支持的导出格式 %q", format)
+	}
+	file, err := os.Create(filepath.Join(dir, "ticks."+format))
+	if err != nil {
+		return nil, err
+	}
+	if format == EXPORT_CSV {
+		w := &csvWriter{file: file, w: csv.NewWriter(file)}
+		if err := w.w.Write(csvHeader); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return w, nil
+	}
+	buf := bufio.NewWriter(file)
+	return &jsonLinesWriter{file: file, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// pendingRow 等待下一帧推断出移动按键后再写出的行
+type pendingRow struct {
+	row   TickRow
+	frame int
+}
+
+// exportFrame 为本 tick 刚录制的帧生成一行。
+// 移动按键要等下一帧才能推断出来，所以每个玩家先写出上一行。
+func (s *demoState) exportFrame(player *common.Player, round int) error {
+	if len(s.exporters) == 0 {
+		return nil
+	}
+	key := playerKey(player)
+	recording := s.enc.Recording(key)
+	ticks := s.frameTicks[key]
+	if recording == nil || len(ticks) == 0 || ticks[len(ticks)-1] != s.tick {
+		return nil
+	}
+	if err := s.flushRow(key); err != nil {
+		return err
+	}
+
+	idx := recording.FrameCount() - 1
+	frame := recording.Frame(idx)
+	row := TickRow{
+		Tick:     s.tick,
+		Round:    round,
+		SteamID:  player.SteamID64,
+		Name:     player.Name,
+		Team:     teamSideName(player.Team),
+		Origin:   frame.Origin,
+		Velocity: frame.ActualVelocity,
+		Angles:   frame.PredictedAngles,
+		Health:   player.Health(),
+		Armor:    player.Armor(),
+		Money:    player.Money(),
+	}
+	if weapon := player.ActiveWeapon(); weapon != nil {
+		row.Weapon = weapon.String()
+		row.WeaponID = int32(WeaponMap[row.Weapon])
+	}
+	s.pending[key] = &pendingRow{row: row, frame: idx}
+	return nil
+}
+
+func (s *demoState) flushRow(key uint64) error {
+	pending := s.pending[key]
+	if pending == nil {
+		return nil
+	}
+	delete(s.pending, key)
+	if recording := s.enc.Recording(key); recording != nil {
+		if frame := recording.Frame(pending.frame); frame != nil {
+			pending.row.Buttons = frame.PlayerButtons
+		}
+	}
+	for _, w := range s.exporters {
+		if err := w.WriteRow(&pending.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushRows 写出所有等待中的行，需要在回合结束、录像被裁剪或保存之前调用
+func (s *demoState) flushRows() error {
+	keys := make([]uint64, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, key := range keys {
+		if err := s.flushRow(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeExporters 关闭所有导出文件，可以重复调用
+func (s *demoState) closeExporters() error {
+	var firstErr error
+	for _, w := range s.exporters {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.exporters = nil
+	return firstErr
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"math"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+const (
+	// 点射模式一次按键射出的子弹数
+	burstShots = 3
+	// 点射中相邻两发子弹的最大间隔 (秒)
+	burstInterval = 0.1
+)
+
+// fireMode 武器当前的射击方式
+type fireMode struct {
+	// 全自动武器的射击间隔 (秒)
+	cycle     float64
+	automatic bool
+	// 格洛克、法玛斯的点射模式
+	burst bool
+}
+
+func weaponFireMode(weapon *common.Equipment) fireMode {
+	if weapon == nil {
+		return fireMode{}
+	}
+	var mode fireMode
+	if weapon.Entity != nil {
+		if burst, ok := weapon.Entity.PropertyValue("m_bBurstMode"); ok && burst.BoolVal() {
+			mode.burst = true
+			return mode
+		}
+	}
+	mode.cycle, mode.automatic = WeaponCycleTime(WeaponStr2ID(weapon.String()))
+	return mode
+}
+
+// cycleTicks 返回下一发子弹最早射出的 tick 与本次开火的间隔，即射击间隔之后的第一个 tick
+func cycleTicks(cycle, tickrate float64) int {
+	// 扣除浮点误差，避免间隔恰好为整数个 tick 时多按一个 tick
+	return int(math.Ceil(cycle*tickrate - 1e-6))
+}
+
+// shotState 玩家最近一次开火
+type shotState struct {
+	tick int
+	// 按下开火键的 tick，点射中后续的子弹不需要重新按下
+	pressTick int
+	// 全自动武器在 (tick, holdUntil) 内继续按住开火键
+	holdUntil int
+	// 当前点射已经射出的子弹数
+	burst int
+}
+
+// fireSource 根据开火事件还原开火键。
+// 全自动武器开火后按住开火键，直到下一发子弹本应射出的 tick 之前：
+// 连续射击时下一发子弹的事件接上按键，形成一次完整的扫射；停止射击时在下一发子弹之前松开，不会多射出子弹。
+// 半自动武器 (手枪、狙击枪、霰弹枪) 每发子弹只按下一个 tick，点射模式只在第一发子弹时按下。
+type fireSource struct {
+	shots map[uint64]*shotState
+}
+
+func (s *fireSource) Register(parser dem.Parser) {
+	parser.RegisterEventHandler(func(e events.WeaponFire) {
+		gs := parser.GameState()
+		if gs.IsWarmupPeriod() || e.Shooter == nil {
+			return
+		}
+		// 道具的投掷键由 grenadeButtons 根据保险状态记录
+		if e.Weapon != nil && e.Weapon.Class() == common.EqClassGrenade {
+			return
+		}
+		s.fire(playerKey(e.Shooter), gs.IngameTick(), weaponFireMode(e.Weapon), parser.TickRate())
+	})
+}
+
+func (s *fireSource) fire(key uint64, tick int, mode fireMode, tickrate float64) {
+	if s.shots == nil {
+		s.shots = make(map[uint64]*shotState)
+	}
+	last := s.shots[key]
+	shot := &shotState{tick: tick, pressTick: tick, holdUntil: tick + 1, burst: 1}
+	switch {
+	case mode.burst:
+		if last != nil && last.burst < burstShots && tick-last.tick <= int(math.Ceil(burstInterval*tickrate)) {
+			shot.pressTick = last.pressTick
+			shot.burst = last.burst + 1
+		}
+	case mode.automatic:
+		shot.holdUntil = tick + cycleTicks(mode.cycle, tickrate)
+	}
+	s.shots[key] = shot
+}
+
+func (s *fireSource) Buttons(player *common.Player, tick int) int32 {
+	shot := s.shots[playerKey(player)]
+	if shot == nil {
+		return 0
+	}
+	if tick == shot.pressTick || (tick > shot.tick && tick < shot.holdUntil) {
+		return IN_ATTACK
+	}
+	return 0
+}
+
+func (s *fireSource) Reset() {
+	s.shots = nil
+}
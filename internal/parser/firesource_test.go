@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func TestCycleTicks(t *testing.T) {
+	tests := []struct {
+		weapon   CSWeaponID
+		tickrate float64
+		want     int
+	}{
+		{CSWeapon_AK47, 64, 7},
+		{CSWeapon_AK47, 128, 13},
+		{CSWeapon_M4A1, 64, 6},
+		{CSWeapon_M4A1, 128, 12},
+		{CSWeapon_M4A1_SILENCER, 64, 7},
+		// 间隔恰好为整数个 tick 时不多按
+		{CSWeapon_XM1014, 20, 7},
+	}
+	for _, tt := range tests {
+		cycle, ok := WeaponCycleTime(tt.weapon)
+		if !ok {
+			t.Fatalf("武器 %d 不是全自动武器", tt.weapon)
+		}
+		if got := cycleTicks(cycle, tt.tickrate); got != tt.want {
+			t.Errorf("武器 %d @%g: cycleTicks = %d, 期望 %d", tt.weapon, tt.tickrate, got, tt.want)
+		}
+	}
+	if _, ok := WeaponCycleTime(CSWeapon_GLOCK); ok {
+		t.Error("格洛克不应按住开火键")
+	}
+}
+
+// pressedTicks 在 shots 中的每个 tick 开火，返回 [first, last] 内按下开火键的 tick
+func pressedTicks(mode fireMode, tickrate float64, shots []int, first, last int) []int {
+	source := &fireSource{}
+	player := &common.Player{SteamID64: 76561198034202275}
+	pressed := []int{}
+	for tick := first; tick <= last; tick++ {
+		for _, shot := range shots {
+			if shot == tick {
+				// 开火事件在同一 tick 的 FrameDone 之前分发
+				source.fire(playerKey(player), tick, mode, tickrate)
+			}
+		}
+		if source.Buttons(player, tick) == IN_ATTACK {
+			pressed = append(pressed, tick)
+		}
+	}
+	return pressed
+}
+
+func TestFireSourceHold(t *testing.T) {
+	ak, _ := WeaponCycleTime(CSWeapon_AK47)
+	m4, _ := WeaponCycleTime(CSWeapon_M4A1)
+	tests := []struct {
+		name     string
+		mode     fireMode
+		tickrate float64
+		shots    []int
+		want     []int
+	}{
+		// 全自动武器按住到下一发子弹本应射出之前
+		{"ak_64", fireMode{cycle: ak, automatic: true}, 64, []int{100}, []int{100, 101, 102, 103, 104, 105, 106}},
+		{"ak_128", fireMode{cycle: ak, automatic: true}, 128, []int{100},
+			[]int{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112}},
+		// 连续射击时按键连成一次扫射
+		{"m4_spray_64", fireMode{cycle: m4, automatic: true}, 64, []int{100, 106},
+			[]int{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111}},
+		{"m4_128", fireMode{cycle: m4, automatic: true}, 128, []int{100},
+			[]int{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111}},
+		// 半自动武器每发子弹只按下一个 tick
+		{"pistol_taps", fireMode{}, 64, []int{100, 110, 111}, []int{100, 110, 111}},
+	}
+	for _, tt := range tests {
+		if got := pressedTicks(tt.mode, tt.tickrate, tt.shots, 90, 130); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 按下开火键的 tick %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFireSourceBurst(t *testing.T) {
+	burst := fireMode{burst: true}
+	tests := []struct {
+		name     string
+		tickrate float64
+		shots    []int
+		want     []int
+	}{
+		// 格洛克、法玛斯的点射只在第一发子弹时按下
+		{"burst_64", 64, []int{100, 102, 104}, []int{100}},
+		{"burst_128", 128, []int{100, 104, 108}, []int{100}},
+		// 一次点射最多 3 发，第 4 发是新的点射
+		{"consecutive_bursts", 64, []int{100, 102, 104, 106, 108}, []int{100, 106}},
+		// 间隔超过点射间隔的子弹需要重新按下
+		{"separate_shots", 64, []int{100, 120}, []int{100, 120}},
+	}
+	for _, tt := range tests {
+		if got := pressedTicks(burst, tt.tickrate, tt.shots, 90, 130); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 按下开火键的 tick %v, 期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
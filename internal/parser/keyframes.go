@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"math"
+
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// MOVETYPE_LADDER 玩家在梯子上时的 movetype
+const MOVETYPE_LADDER = 9
+
+// 相邻两帧视角变化超过该角度时视为甩枪，需要同步视角
+const flickThreshold = 30.0
+
+// FrameContext 判断关键帧时可用的玩家状态
+type FrameContext struct {
+	TickRate float64
+	// 该帧在录像中的序号，流式写出时 frames 只包含最近的帧
+	FrameIndex int
+	// 冻结时间内的帧
+	FullSnap bool
+	Airborne bool
+	OnLadder bool
+}
+
+// KeyframeStrategy 决定哪些帧需要同步位置与速度 (FIELDS_ORIGIN | FIELDS_VELOCITY)。
+// 每段录像使用单独的实例，可以在内部保存状态。
+type KeyframeStrategy interface {
+	// IsKeyframe 在 frame 追加到 frames 之前调用，此时 frames 最后一帧的移动输入已经确定
+	IsKeyframe(frames []rec.FrameInfo, frame *rec.FrameInfo, ctx FrameContext) bool
+}
+
+// KeyframeStrategyFactory 为每段录像创建关键帧策略
+type KeyframeStrategyFactory func() KeyframeStrategy
+
+// FixedKeyframes 冻结时间内的每一帧以及每隔 2 秒插入一个关键帧
+type FixedKeyframes struct{}
+
+func (FixedKeyframes) IsKeyframe(frames []rec.FrameInfo, frame *rec.FrameInfo, ctx FrameContext) bool {
+	return ctx.FullSnap || ctx.FrameIndex%int(ctx.TickRate*2) == 0
+}
+
+func NewFixedKeyframes() KeyframeStrategy {
+	return FixedKeyframes{}
+}
+
+func playerOnLadder(player *common.Player) bool {
+	if player.Entity == nil {
+		return false
+	}
+	moveType, ok := player.Entity.PropertyValue("movetype")
+	return ok && moveType.IntVal == MOVETYPE_LADDER
+}
+
+// angleDelta 返回 from 到 to 的角度差，范围 [-180, 180)
+func angleDelta(from, to float32) float32 {
+	delta := math.Mod(float64(to-from)+180.0, 360.0)
+	if delta < 0 {
+		delta += 360.0
+	}
+	return float32(delta - 180.0)
+}
+
+// isViewFlick 判断两帧之间是否出现大幅度的视角变化
+func isViewFlick(prev, curr *rec.FrameInfo) bool {
+	pitch := angleDelta(prev.PredictedAngles[0], curr.PredictedAngles[0])
+	yaw := angleDelta(prev.PredictedAngles[1], curr.PredictedAngles[1])
+	return math.Hypot(float64(pitch), float64(yaw)) > flickThreshold
+}
+
+// keyframeAngles 返回关键帧使用的视角 (pitch, yaw, roll)，pitch 转换到 [-180, 180)
+func keyframeAngles(frame *rec.FrameInfo) [3]float32 {
+	return [3]float32{angleDelta(0, frame.PredictedAngles[0]), frame.PredictedAngles[1], 0}
+}
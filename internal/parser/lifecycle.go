@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"sort"
+
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// finishPlayer 玩家死亡或离开时追加最后一帧，让 bot 停在最后的位置上。
+// 之后该玩家不再录制新的帧，除非在同一回合内复活。
+func (s *demoState) finishPlayer(player *common.Player) {
+	if player == nil {
+		return
+	}
+	key := playerKey(player)
+	recording := s.enc.Recording(key)
+	if recording == nil || s.finished[key] || len(recording.Frames) == 0 {
+		return
+	}
+	s.finished[key] = true
+
+	last := &recording.Frames[len(recording.Frames)-1]
+	frame := rec.FrameInfo{
+		PredictedAngles:  last.PredictedAngles,
+		Origin:           last.Origin,
+		AdditionalFields: rec.FIELDS_ORIGIN | rec.FIELDS_ANGLES | rec.FIELDS_VELOCITY,
+		AtOrigin:         last.Origin,
+		AtAngles:         keyframeAngles(last),
+	}
+	s.addFrame(key, recording, frame)
+}
+
+// resumePlayer 玩家在回合内复活时继续录制，返回 true 表示刚刚复活
+func (s *demoState) resumePlayer(player *common.Player) bool {
+	key := playerKey(player)
+	if !s.finished[key] {
+		return false
+	}
+	delete(s.finished, key)
+	s.playerLastZ[key] = float32(player.Position().Z)
+	return true
+}
+
+// playerDisconnected 离开的玩家在回合结束时仍然保存录像
+func (s *demoState) playerDisconnected(player *common.Player) {
+	if player == nil || s.enc.Recording(playerKey(player)) == nil {
+		return
+	}
+	s.finishPlayer(player)
+	s.departed[playerKey(player)] = player
+	if manifest := s.players[playerKey(player)]; manifest != nil {
+		manifest.Disconnected = true
+	}
+}
+
+// needsInit 判断玩家在本回合是否还没有开始录制，用于处理冻结时间结束后才加入的玩家
+func (s *demoState) needsInit(player *common.Player) bool {
+	return player.IsAlive() && s.players[playerKey(player)] == nil
+}
+
+// sortPlayers 按 SteamID64 (bot 为 UserID) 排序。
+// TeamState.Members() 的顺序来自 map 遍历，每次解析都不同。
+func sortPlayers(players []*common.Player) {
+	sort.SliceStable(players, func(i, j int) bool {
+		if players[i] == nil || players[j] == nil {
+			return players[j] == nil && players[i] != nil
+		}
+		return playerKey(players[i]) < playerKey(players[j])
+	})
+}
+
+func containsPlayer(players []*common.Player, key uint64) bool {
+	for _, player := range players {
+		if player != nil && playerKey(player) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+const manifestFileName = "manifest.json"
+
+// Loadout 玩家开始录制时的装备
+type Loadout struct {
+	Weapons   []string `json:"weapons"`
+	Armor     int      `json:"armor"`
+	Helmet    bool     `json:"helmet"`
+	DefuseKit bool     `json:"defuse_kit"`
+	Money     int      `json:"money"`
+}
+
+// PlayerManifest 单个玩家在一个回合内的录像信息
+type PlayerManifest struct {
+	SteamID uint64 `json:"steamid,string"`
+	Name    string `json:"name"`
+	Team    string `json:"team"`
+	// 相对 demo 输出目录的路径
+	File   string `json:"file"`
+	Frames int    `json:"frames"`
+	// 死亡时的 tick，存活到回合结束时为空
+	DeathTick *int    `json:"death_tick,omitempty"`
+	Loadout   Loadout `json:"loadout"`
+	// 回合结束前离开了服务器
+	Disconnected bool `json:"disconnected,omitempty"`
+}
+
+// RoundManifest 单个回合的元数据
+type RoundManifest struct {
+	Map               string  `json:"map"`
+	TickRate          float64 `json:"tick_rate"`
+	Round             int     `json:"round"`
+	Winner            string  `json:"winner"`
+	Reason            string  `json:"reason"`
+	ScoreT            int     `json:"score_t"`
+	ScoreCT           int     `json:"score_ct"`
+	StartTick         int     `json:"start_tick"`
+	FreezetimeEndTick int     `json:"freezetime_end_tick"`
+	EndTick           int     `json:"end_tick"`
+	Halftime          bool    `json:"halftime"`
+	// 切片后保存的 tick 范围，未切片时为空
+	SliceFromTick int              `json:"slice_from_tick,omitempty"`
+	SliceToTick   int              `json:"slice_to_tick,omitempty"`
+	Players       []PlayerManifest `json:"players"`
+}
+
+// DemoManifest 整个 demo 的元数据，写入 <demo输出目录>/manifest.json
+type DemoManifest struct {
+	Demo     string          `json:"demo"`
+	Map      string          `json:"map"`
+	TickRate float64         `json:"tick_rate"`
+	Rounds   []RoundManifest `json:"rounds"`
+}
+
+var roundEndReasonNames = map[events.RoundEndReason]string{
+	events.RoundEndReasonTargetBombed:         "target_bombed",
+	events.RoundEndReasonVIPEscaped:           "vip_escaped",
+	events.RoundEndReasonVIPKilled:            "vip_killed",
+	events.RoundEndReasonTerroristsEscaped:    "terrorists_escaped",
+	events.RoundEndReasonCTStoppedEscape:      "ct_stopped_escape",
+	events.RoundEndReasonTerroristsStopped:    "terrorists_stopped",
+	events.RoundEndReasonBombDefused:          "bomb_defused",
+	events.RoundEndReasonCTWin:                "ct_win",
+	events.RoundEndReasonTerroristsWin:        "terrorists_win",
+	events.RoundEndReasonDraw:                 "draw",
+	events.RoundEndReasonHostagesRescued:      "hostages_rescued",
+	events.RoundEndReasonTargetSaved:          "target_saved",
+	events.RoundEndReasonHostagesNotRescued:   "hostages_not_rescued",
+	events.RoundEndReasonTerroristsNotEscaped: "terrorists_not_escaped",
+	events.RoundEndReasonVIPNotEscaped:        "vip_not_escaped",
+	events.RoundEndReasonGameStart:            "game_start",
+	events.RoundEndReasonTerroristsSurrender:  "terrorists_surrender",
+	events.RoundEndReasonCTSurrender:          "ct_surrender",
+}
+
+func teamSideName(team common.Team) string {
+	switch team {
+	case common.TeamTerrorists:
+		return "t"
+	case common.TeamCounterTerrorists:
+		return "ct"
+	}
+	return ""
+}
+
+func playerLoadout(player *common.Player) Loadout {
+	loadout := Loadout{
+		Weapons:   []string{},
+		Armor:     player.Armor(),
+		Helmet:    player.HasHelmet(),
+		DefuseKit: player.HasDefuseKit(),
+		Money:     player.Money(),
+	}
+	for _, weapon := range player.Weapons() {
+		if weapon != nil {
+			loadout.Weapons = append(loadout.Weapons, weapon.String())
+		}
+	}
+	sort.Strings(loadout.Weapons)
+	return loadout
+}
+
+// newRoundManifest 根据回合结束事件生成回合元数据
+func newRoundManifest(round *RoundInfo, e events.RoundEnd, scoreT, scoreCT int) RoundManifest {
+	// RoundEnd 时 TeamState.Score() 还没有更新，需要给胜者加一分
+	switch e.Winner {
+	case common.TeamTerrorists:
+		scoreT++
+	case common.TeamCounterTerrorists:
+		scoreCT++
+	}
+	return RoundManifest{
+		Round:             round.roundNum,
+		Winner:            teamSideName(e.Winner),
+		Reason:            roundEndReasonNames[e.Reason],
+		ScoreT:            scoreT,
+		ScoreCT:           scoreCT,
+		StartTick:         round.freezetimeStart,
+		FreezetimeEndTick: round.freezetimeEnd,
+		EndTick:           round.roundEnd,
+		Halftime:          round.isHalftime,
+		Players:           []PlayerManifest{},
+	}
+}
+
+func writeManifest(dir string, manifest interface{}) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFileName), data, 0644)
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"math"
+
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+// Since I don't know how to get player's button bits in a tick frame,
+// movement input is inferred from *actual vels* and *angles*.
+// The source engine applies the input of tick N-1 to produce the velocity of tick N,
+// so the velocity change between two frames tells us what the player was pressing.
+
+const (
+	// cl_forwardspeed / cl_sidespeed
+	moveSpeed float32 = 450.0
+	// 竞技模式下的 sv_friction / sv_stopspeed / sv_accelerate
+	svFriction   = 5.2
+	svStopSpeed  = 80.0
+	svAccelerate = 5.5
+	// 持刀时的最大速度，用于估算一个 tick 内的加速度
+	maxGroundSpeed = 250.0
+	// 低于该水平速度视为静止
+	minMoveSpeed = 1.0
+	// 速度方向偏离某个按键方向超过该角度时不视为按下该键
+	directionThreshold = 30.0
+)
+
+// moveInput 一帧的移动输入，与 BotMimic 的 PredictedVelocity 对应
+type moveInput struct {
+	forward float32
+	side    float32
+}
+
+// buttons 返回与移动输入一致的按键位
+func (m moveInput) buttons() int32 {
+	var button int32 = 0
+	if m.forward > 0 {
+		button |= IN_FORWARD
+	} else if m.forward < 0 {
+		button |= IN_BACK
+	}
+	if m.side < 0 {
+		button |= IN_MOVELEFT
+	} else if m.side > 0 {
+		button |= IN_MOVERIGHT
+	}
+	return button
+}
+
+const movementButtons = IN_FORWARD | IN_BACK | IN_MOVELEFT | IN_MOVERIGHT
+
+// buttonMovement 返回与按键一致的移动输入，用于按键来源直接给出移动键的帧
+func buttonMovement(buttons int32) moveInput {
+	var input moveInput
+	if buttons&IN_FORWARD != 0 {
+		input.forward = moveSpeed
+	} else if buttons&IN_BACK != 0 {
+		input.forward = -moveSpeed
+	}
+	if buttons&IN_MOVELEFT != 0 {
+		input.side = -moveSpeed
+	} else if buttons&IN_MOVERIGHT != 0 {
+		input.side = moveSpeed
+	}
+	return input
+}
+
+// applyMovement 将推断出的输入写入帧的 PredictedVelocity 与按键
+func applyMovement(frame *rec.FrameInfo, input moveInput) {
+	frame.PredictedVelocity[0] = input.forward
+	frame.PredictedVelocity[1] = input.side
+	frame.PlayerButtons = (frame.PlayerButtons &^ movementButtons) | input.buttons()
+}
+
+// inferMovement 根据 frames[idx] 到 next 的速度变化推断 frames[idx] 的移动输入
+func inferMovement(frames []rec.FrameInfo, idx int, next *rec.FrameInfo, tickrate float64, airborne bool) moveInput {
+	prev := &frames[idx]
+	prevX, prevY := float64(prev.ActualVelocity[0]), float64(prev.ActualVelocity[1])
+	currX, currY := float64(next.ActualVelocity[0]), float64(next.ActualVelocity[1])
+	prevSpeed := math.Hypot(prevX, prevY)
+	currSpeed := math.Hypot(currX, currY)
+	if prevSpeed < minMoveSpeed && currSpeed < minMoveSpeed {
+		return moveInput{}
+	}
+	frametime := 1.0 / tickrate
+
+	var wishX, wishY float64
+	if airborne {
+		// 空中没有摩擦力，速度变化全部来自输入
+		wishX, wishY = currX-prevX, currY-prevY
+		if math.Hypot(wishX, wishY) < minMoveSpeed {
+			// 空中速度达到上限后输入不再改变速度，沿用起跳前的输入
+			if idx > 0 {
+				return moveInput{frames[idx-1].PredictedVelocity[0], frames[idx-1].PredictedVelocity[1]}
+			}
+			wishX, wishY = currX, currY
+		}
+	} else {
+		// 先扣除摩擦力造成的减速，剩下的速度变化来自输入
+		drop := math.Max(prevSpeed, svStopSpeed) * svFriction * frametime
+		expectedX, expectedY := 0.0, 0.0
+		if prevSpeed > drop {
+			scale := (prevSpeed - drop) / prevSpeed
+			expectedX, expectedY = prevX*scale, prevY*scale
+		}
+		wishX, wishY = currX-expectedX, currY-expectedY
+		// 减速幅度与摩擦力相当时说明玩家松开了按键
+		accel := svAccelerate * maxGroundSpeed * frametime
+		if math.Hypot(wishX, wishY) < math.Min(drop, accel)*0.5 {
+			return moveInput{}
+		}
+	}
+	return quantizeMovement(wishX, wishY, float64(prev.PredictedAngles[1]))
+}
+
+// quantizeMovement 将世界坐标系下的期望移动方向转换为相对视角的 WASD 输入
+func quantizeMovement(wishX, wishY float64, yaw float64) moveInput {
+	wishAngle := radian2degree(math.Atan2(wishY, wishX))
+	faceFront := normalizeDegree(yaw)
+	deltaAngle := normalizeDegree(wishAngle - faceFront)
+
+	var input moveInput
+	const threshold = directionThreshold
+	if 0.0+threshold < deltaAngle && deltaAngle < 180.0-threshold {
+		input.side = -moveSpeed // left
+	}
+	if 90.0+threshold < deltaAngle && deltaAngle < 270.0-threshold {
+		input.forward = -moveSpeed // back
+	}
+	if 180.0+threshold < deltaAngle && deltaAngle < 360.0-threshold {
+		input.side = moveSpeed // right
+	}
+	if 270.0+threshold < deltaAngle || deltaAngle < 90.0-threshold {
+		input.forward = moveSpeed // front
+	}
+	return input
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+func TestInferMovement(t *testing.T) {
+	const tickrate = 64.0
+	// 一个 tick 内从静止加速得到的速度
+	accel := float32(svAccelerate * maxGroundSpeed / tickrate)
+	// 250 速度下只受摩擦力时下一帧的速度
+	coast := float32(250 - 250*svFriction/tickrate)
+
+	tests := []struct {
+		name     string
+		velocity [2]float32
+		next     [2]float32
+		yaw      float32
+		want     moveInput
+	}{
+		{"forward", [2]float32{0, 0}, [2]float32{accel, 0}, 0, moveInput{forward: moveSpeed}},
+		{"back", [2]float32{0, 0}, [2]float32{0, -accel}, 90, moveInput{forward: -moveSpeed}},
+		{"strafe_left", [2]float32{0, 0}, [2]float32{0, accel}, 0, moveInput{side: -moveSpeed}},
+		{"strafe_right", [2]float32{0, 0}, [2]float32{0, -accel}, 0, moveInput{side: moveSpeed}},
+		{"forward_left", [2]float32{0, 0}, [2]float32{accel, accel}, 0, moveInput{forward: moveSpeed, side: -moveSpeed}},
+		// 保持最大速度时输入抵消摩擦力
+		{"keep_running", [2]float32{250, 0}, [2]float32{250, 0}, 0, moveInput{forward: moveSpeed}},
+		// 只有摩擦力减速时视为松开按键
+		{"stop", [2]float32{250, 0}, [2]float32{coast, 0}, 0, moveInput{}},
+		{"standing", [2]float32{0, 0}, [2]float32{0, 0}, 0, moveInput{}},
+	}
+	for _, tt := range tests {
+		frames := []rec.FrameInfo{{}}
+		frames[0].ActualVelocity = [3]float32{tt.velocity[0], tt.velocity[1], 0}
+		frames[0].PredictedAngles[1] = tt.yaw
+		next := &rec.FrameInfo{ActualVelocity: [3]float32{tt.next[0], tt.next[1], 0}}
+		if got := inferMovement(frames, 0, next, tickrate, false); got != tt.want {
+			t.Errorf("%s: 推断的输入 %+v, 期望 %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInferMovementAirborne(t *testing.T) {
+	// 空中速度不变时沿用上一帧的输入
+	frames := make([]rec.FrameInfo, 2)
+	frames[0].PredictedVelocity = [3]float32{0, moveSpeed, 0}
+	frames[1].ActualVelocity = [3]float32{250, 0, 100}
+	next := &rec.FrameInfo{ActualVelocity: [3]float32{250, 0, 90}}
+	if got, want := inferMovement(frames, 1, next, 64, true), (moveInput{side: moveSpeed}); got != want {
+		t.Errorf("推断的输入 %+v, 期望 %+v", got, want)
+	}
+}
+
+func TestQuantizeMovement(t *testing.T) {
+	tests := []struct {
+		wishX, wishY, yaw float64
+		want              moveInput
+	}{
+		{1, 0, 0, moveInput{forward: moveSpeed}},
+		{0, 1, 90, moveInput{forward: moveSpeed}},
+		{-1, 0, 0, moveInput{forward: -moveSpeed}},
+		{0, 1, 0, moveInput{side: -moveSpeed}},
+		{0, -1, 0, moveInput{side: moveSpeed}},
+		{-1, -1, 0, moveInput{forward: -moveSpeed, side: moveSpeed}},
+		// 偏离按键方向不超过阈值时只按一个键
+		{1, 0.3, 0, moveInput{forward: moveSpeed}},
+	}
+	for _, tt := range tests {
+		got := quantizeMovement(tt.wishX, tt.wishY, tt.yaw)
+		if got != tt.want {
+			t.Errorf("quantizeMovement(%g, %g, %g) = %+v, 期望 %+v", tt.wishX, tt.wishY, tt.yaw, got, tt.want)
+		}
+		if buttons := got.buttons(); buttonMovement(buttons) != got {
+			t.Errorf("按键 %b 与输入 %+v 不一致", buttons, got)
+		}
+	}
+}
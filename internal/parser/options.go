@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// Options 控制解析哪些回合与玩家，以及输出位置
+type Options struct {
+	// 输出根目录，录像保存在 <OutDir>/<demo名称>/ 下
+	OutDir string
+	// 需要导出的回合，为空时导出全部回合
+	Rounds RoundSet
+	// 需要导出的玩家名或 SteamID64，均为空时导出全部玩家
+	Players  []string
+	SteamIDs []uint64
+	// 需要导出的阵营 "t" 或 "ct"，为空时导出双方
+	Team string
+	// 从冻结时间结束开始录制；为 false 时从回合开始录制，冻结时间内每帧均为关键帧
+	SkipFreezetime bool
+	// 关键帧策略，为空时使用 FixedKeyframes
+	Keyframes KeyframeStrategyFactory
+	// 道具模式：不导出整回合录像，而是为每个投掷的道具截取一段从投掷前 UtilityLeadTime 秒到落地的录像
+	Utility         bool
+	UtilityLeadTime float64
+	// 同时导出的逐帧表格格式 "jsonl" / "csv"，写入 <demo输出目录>/ticks.<格式>
+	Export []string
+	// 流式写出录像，内存中每个玩家只保留最近的帧；切片与道具模式需要完整的录像，此时不生效
+	Stream bool
+	// 流式写出的临时文件目录，为空时使用系统临时目录
+	SpoolDir string
+	// 录像文件头中的时间戳，默认为当前时间
+	Timestamp TimestampSource
+	// 写出的 BotMimic 格式版本，为 0 时使用默认版本
+	FormatVersion int8
+	// 启用的按键来源，为 nil 时启用全部来源，见 ResolveButtonSources
+	ButtonSources []string
+	// 将每帧按键的来源写入 <demo输出目录>/buttons.jsonl，用于调试
+	ButtonTrace bool
+	// 只保存 [From, To] 范围内的帧，为空时不限制；道具模式下忽略
+	From *TickBound
+	To   *TickBound
+}
+
+func DefaultOptions() Options {
+	return Options{
+		OutDir:          "output",
+		SkipFreezetime:  true,
+		Stream:          true,
+		Keyframes:       NewFixedKeyframes,
+		UtilityLeadTime: 3,
+	}
+}
+
+// RoundSet 回合号集合
+type RoundSet map[int]bool
+
+// ParseRounds 解析形如 "3-7,12" 的回合列表
+func ParseRounds(s string) (RoundSet, error) {
+	rounds := make(RoundSet)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("非法的回合号 %q", part)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, fmt.Errorf("非法的回合号 %q", part)
+			}
+		}
+		if first < 1 || last < first {
+			return nil, fmt.Errorf("非法的回合范围 %q", part)
+		}
+		for round := first; round <= last; round++ {
+			rounds[round] = true
+		}
+	}
+	return rounds, nil
+}
+
+// ParseSteamIDs 解析逗号分隔的 SteamID64 列表
+func ParseSteamIDs(s string) ([]uint64, error) {
+	var steamIDs []uint64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		steamID, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("非法的SteamID64 %q", part)
+		}
+		steamIDs = append(steamIDs, steamID)
+	}
+	return steamIDs, nil
+}
+
+func (opts *Options) wantRound(roundNum int) bool {
+	return len(opts.Rounds) == 0 || opts.Rounds[roundNum]
+}
+
+func (opts *Options) wantPlayer(player *common.Player) bool {
+	switch opts.Team {
+	case "t":
+		if player.Team != common.TeamTerrorists {
+			return false
+		}
+	case "ct":
+		if player.Team != common.TeamCounterTerrorists {
+			return false
+		}
+	}
+	if len(opts.Players) == 0 && len(opts.SteamIDs) == 0 {
+		return true
+	}
+	for _, name := range opts.Players {
+		if strings.EqualFold(name, player.Name) {
+			return true
+		}
+	}
+	for _, steamID := range opts.SteamIDs {
+		if steamID == player.SteamID64 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRounds(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{"3-7,12", []int{3, 4, 5, 6, 7, 12}, false},
+		{" 1 , 2 - 3 ", []int{1, 2, 3}, false},
+		{"5-5", []int{5}, false},
+		{"1,,2", []int{1, 2}, false},
+		{"", nil, false},
+		{"7-3", nil, true},
+		{"0", nil, true},
+		{"0-2", nil, true},
+		{"3-", nil, true},
+		{"a", nil, true},
+		{"1-b", nil, true},
+	}
+	for _, tt := range tests {
+		rounds, err := ParseRounds(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRounds(%q) 错误 %v, 期望出错 %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		want := RoundSet{}
+		for _, round := range tt.want {
+			want[round] = true
+		}
+		if !reflect.DeepEqual(rounds, want) {
+			t.Errorf("ParseRounds(%q) = %v, 期望 %v", tt.in, rounds, want)
+		}
+	}
+}
+
+func TestParseSteamIDs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []uint64
+		wantErr bool
+	}{
+		{"76561198034202275", []uint64{76561198034202275}, false},
+		{"76561198034202275, 76561197960287930,", []uint64{76561198034202275, 76561197960287930}, false},
+		{"", nil, false},
+		{"STEAM_1:0:11101", nil, true},
+		{"-1", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSteamIDs(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSteamIDs(%q) 错误 %v, 期望出错 %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSteamIDs(%q) = %v, 期望 %v", tt.in, got, tt.want)
+		}
+	}
+}
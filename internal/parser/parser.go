@@ -1,21 +1,19 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	
-	"github.com/dxldb/minidemo-encoder/internal/encoder"
 	ilog "github.com/dxldb/minidemo-encoder/internal/logger"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
 	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
 )
 
-type TickPlayer struct {
-	tick    int
-	steamid uint64
-}
-
 type RoundInfo struct {
 	roundNum           int
 	freezetimeStart    int
@@ -26,38 +24,91 @@ type RoundInfo struct {
 	started            bool
 	buyTimeEnd         int
 	inventoryCheckTime int
+	// 回合事件第一次发生的 tick
+	events map[string]int
+}
+
+// Result 单个 demo 的解析结果
+type Result struct {
+	DemoName  string
+	OutputDir string
+	// 导出的回合号与写出的录像文件
+	Rounds []int
+	Files  []string
+}
+
+// DemoName 返回 demo 的名称，即去掉扩展名的文件名，录像保存在 <OutDir>/<名称>/ 下
+func DemoName(filePath string) string {
+	demoFileName := filepath.Base(filePath)
+	return strings.TrimSuffix(demoFileName, filepath.Ext(demoFileName))
 }
-var outputBaseDir string
 
-func Start(filePath string) {
+// Start 解析 demo 并导出录像。
+// 每次调用的状态都是独立的，可以在多个 goroutine 中同时解析不同的 demo。
+// 出错时返回 *DemoError，Result 中保留出错前已经写出的文件。
+func Start(filePath string, opts Options) (Result, error) {
+	demoName := DemoName(filePath)
+
+	outputBaseDir := filepath.Join(opts.OutDir, demoName)
+	result := Result{DemoName: demoName, OutputDir: outputBaseDir}
+
 	iFile, err := os.Open(filePath)
-	checkError(err)
+	if err != nil {
+		return result, &DemoError{Demo: filePath, Op: "open", Err: err}
+	}
+	defer iFile.Close()
 
 	iParser := dem.NewParser(iFile)
 	defer iParser.Close()
 
-	demoFileName := filepath.Base(filePath)
-	demoName := strings.TrimSuffix(demoFileName, filepath.Ext(demoFileName))
-
-	outputBaseDir = filepath.Join("output", demoName)
-
 	err = os.MkdirAll(outputBaseDir, os.ModePerm)
 	if err != nil {
-		ilog.ErrorLogger.Printf("创建输出目录失败: %s\n", err.Error())
-		return
+		return result, &DemoError{Demo: filePath, Op: "mkdir", Err: err}
 	}
 
-	encoder.SetSaveDir(outputBaseDir)
+	enc := rec.NewEncoder(outputBaseDir)
+	clock, err := opts.Timestamp.clock()
+	if err != nil {
+		return result, &DemoError{Demo: filePath, Op: "timestamp", Err: err}
+	}
+	enc.SetClock(clock)
+	if err := enc.SetFormatVersion(opts.FormatVersion); err != nil {
+		return result, &DemoError{Demo: filePath, Op: "format", Err: err}
+	}
+	defer enc.Close()
+	enc.SetStreaming(opts.Stream && !opts.Utility && opts.From == nil && opts.To == nil, opts.SpoolDir)
+	state := newDemoState(enc, opts.Keyframes)
+	for _, format := range opts.Export {
+		w, err := NewTickWriter(outputBaseDir, format)
+		if err != nil {
+			state.closeExporters()
+			return result, &DemoError{Demo: filePath, Op: "export", Err: err}
+		}
+		state.exporters = append(state.exporters, w)
+	}
+	defer state.closeExporters()
+	state.buttons, err = newButtonPipeline(opts.ButtonSources)
+	if err != nil {
+		return result, &DemoError{Demo: filePath, Op: "buttons", Err: err}
+	}
+	if opts.ButtonTrace {
+		if err := state.buttons.openTrace(outputBaseDir); err != nil {
+			return result, &DemoError{Demo: filePath, Op: "buttons", Err: err}
+		}
+	}
+	defer state.buttons.close()
+	state.buttons.register(iParser)
+	demoManifest := DemoManifest{Demo: demoName, Rounds: []RoundManifest{}}
 
 	ilog.InfoLogger.Printf("输出目录: %s", outputBaseDir)
 
-	var buttonTickMap map[TickPlayer]int32 = make(map[TickPlayer]int32)
-	var playerLastScopedState map[uint64]bool = make(map[uint64]bool)
 	var (
 		roundNum           = 0
 		currentRound       *RoundInfo
 		firstRoundDetected = false
 		gameStarted        = false
+		// 第一个写文件错误，出现后立即停止解析
+		writeErr error
 	)
 
 	iParser.RegisterEventHandler(func(e events.FrameDone) {
@@ -72,32 +123,31 @@ func Start(filePath string) {
 		if !gameStarted || currentRound == nil || !currentRound.started {
 			return
 		}
+		if !opts.wantRound(currentRound.roundNum) {
+			return
+		}
 
 		currentTick := gs.IngameTick()
+		state.tick = currentTick
 
 		tPlayers := gs.TeamTerrorists().Members()
 		ctPlayers := gs.TeamCounterTerrorists().Members()
 		Players := append(tPlayers, ctPlayers...)
+		sortPlayers(Players)
+		// 不跳过冻结时间时从回合开始录制，否则从冻结时间结束开始
+		recordingStarted := !opts.SkipFreezetime || !currentRound.inFreezeTime
 		for _, player := range Players {
 			if player != nil {
-				var addonButton int32 = 0
-				key := TickPlayer{currentTick, player.SteamID64}
-				if val, ok := buttonTickMap[key]; ok {
-					addonButton = val
-					delete(buttonTickMap, key)
+				if recordingStarted && opts.wantPlayer(player) && state.needsInit(player) {
+					ilog.InfoLogger.Printf("  玩家 %s 在回合中途加入，开始录制", player.Name)
+					state.parsePlayerInitFrame(player)
 				}
-
-				steamID := player.SteamID64
-				currentScoped := player.IsScoped()
-				lastScoped, exists := playerLastScopedState[steamID]
-
-				if !exists {
-					playerLastScopedState[steamID] = currentScoped
-				} else if currentScoped != lastScoped {
-					addonButton |= IN_ATTACK2
-					playerLastScopedState[steamID] = currentScoped
+				state.parsePlayerFrame(player, iParser.TickRate(), currentRound.inFreezeTime)
+				if err := state.exportFrame(player, currentRound.roundNum); err != nil {
+					writeErr = err
+					iParser.Cancel()
+					return
 				}
-				parsePlayerFrame(player, addonButton, iParser.TickRate(), currentRound.inFreezeTime)
 			}
 		}
 	})
@@ -110,30 +160,66 @@ func Start(filePath string) {
 			return
 		}
 
-		currentTick := gs.IngameTick()
-		key := TickPlayer{currentTick, e.Shooter.SteamID64}
-		if _, ok := buttonTickMap[key]; ok {
-			buttonTickMap[key] |= IN_ATTACK
-		} else {
-			buttonTickMap[key] = IN_ATTACK
+		// 投掷道具不算开火
+		if e.Weapon != nil && e.Weapon.Class() == common.EqClassGrenade {
+			return
 		}
+
+		currentRound.markEvent(EVENT_FIRST_SHOT, gs.IngameTick())
+		state.addFirstShotBookmark(e.Shooter)
 	})
 
-	iParser.RegisterEventHandler(func(e events.PlayerJump) {
-		gs := iParser.GameState()
+	iParser.RegisterEventHandler(func(e events.Kill) {
+		if e.Victim != nil {
+			state.addBookmark(e.Killer, BOOKMARK_KILL+" "+e.Victim.Name)
+		}
+		currentRound.markEvent(EVENT_FIRST_KILL, iParser.GameState().IngameTick())
+		state.finishPlayer(e.Victim)
+		state.addDeathBookmark(e.Victim)
+		state.markDeath(e.Victim, iParser.GameState().IngameTick())
+	})
 
-		// 检查是否在热身
-		if gs.IsWarmupPeriod() {
+	iParser.RegisterEventHandler(func(e events.PlayerDisconnected) {
+		if e.Player != nil && state.enc.Recording(playerKey(e.Player)) != nil {
+			ilog.InfoLogger.Printf("  玩家 %s 在回合中途离开", e.Player.Name)
+		}
+		state.playerDisconnected(e.Player)
+	})
+
+	iParser.RegisterEventHandler(func(e events.BombPlanted) {
+		currentRound.markEvent(EVENT_BOMB_PLANT, iParser.GameState().IngameTick())
+		state.addBookmark(e.Player, BOOKMARK_BOMB_PLANT)
+	})
+
+	iParser.RegisterEventHandler(func(e events.BombDefused) {
+		currentRound.markEvent(EVENT_BOMB_DEFUSE, iParser.GameState().IngameTick())
+		state.addBookmark(e.Player, BOOKMARK_BOMB_DEFUSE)
+	})
+
+	iParser.RegisterEventHandler(func(e events.GrenadeProjectileThrow) {
+		if e.Projectile == nil || e.Projectile.WeaponInstance == nil {
 			return
 		}
+		state.addBookmark(e.Projectile.Thrower, BOOKMARK_THROW+" "+e.Projectile.WeaponInstance.String())
+		if opts.Utility && currentRound != nil {
+			state.trackThrow(e.Projectile, currentRound.roundNum, iParser.GameState().IngameTick())
+		}
+	})
 
-		currentTick := gs.IngameTick()
-		key := TickPlayer{currentTick, e.Player.SteamID64}
-		if _, ok := buttonTickMap[key]; ok {
-			buttonTickMap[key] |= IN_JUMP
-		} else {
-			buttonTickMap[key] = IN_JUMP
+	// 道具起爆时视为落地，燃烧瓶等没有起爆事件的道具以实体销毁为准
+	iParser.RegisterEventHandler(func(e events.GrenadeEventIf) {
+		grenade := e.Base()
+		landing := [3]float32{float32(grenade.Position.X), float32(grenade.Position.Y), float32(grenade.Position.Z)}
+		state.landThrow(grenade.GrenadeEntityID, landing, iParser.GameState().IngameTick())
+	})
+
+	iParser.RegisterEventHandler(func(e events.GrenadeProjectileDestroy) {
+		if e.Projectile == nil || e.Projectile.Entity == nil {
+			return
 		}
+		position := e.Projectile.Position()
+		landing := [3]float32{float32(position.X), float32(position.Y), float32(position.Z)}
+		state.landThrow(e.Projectile.Entity.ID(), landing, iParser.GameState().IngameTick())
 	})
 
 	iParser.RegisterEventHandler(func(e events.GameHalfEnded) {
@@ -198,8 +284,23 @@ func Start(filePath string) {
 			isHalftime:      false,
 			started:         false,
 		}
-		playerLastScopedState = make(map[uint64]bool)
+		state.buttons.reset()
 		currentRound.started = true
+		currentRound.markEvent(EVENT_ROUND_START, currentTick)
+
+		// 不跳过冻结时间时从回合开始录制
+		if !opts.SkipFreezetime && opts.wantRound(roundNum) {
+			tPlayers := gs.TeamTerrorists().Members()
+			ctPlayers := gs.TeamCounterTerrorists().Members()
+			Players := append(tPlayers, ctPlayers...)
+			sortPlayers(Players)
+
+			for _, player := range Players {
+				if player != nil && opts.wantPlayer(player) {
+					state.parsePlayerInitFrame(player)
+				}
+			}
+		}
 	})
 
 	iParser.RegisterEventHandler(func(e events.RoundFreezetimeEnd) {
@@ -215,18 +316,32 @@ func Start(filePath string) {
 
 			currentRound.freezetimeEnd = currentTick
 			currentRound.inFreezeTime = false
+			currentRound.markEvent(EVENT_FREEZETIME_END, currentTick)
+			if !opts.SkipFreezetime || !opts.wantRound(currentRound.roundNum) {
+				return
+			}
 			tPlayers := gs.TeamTerrorists().Members()
 			ctPlayers := gs.TeamCounterTerrorists().Members()
 			Players := append(tPlayers, ctPlayers...)
+			sortPlayers(Players)
 	
 			for _, player := range Players {
-				if player != nil {
-					parsePlayerInitFrame(player)
+				if player != nil && opts.wantPlayer(player) {
+					state.parsePlayerInitFrame(player)
 				}
 			}
 		}
 	})
 
+	iParser.RegisterEventHandler(func(e events.RoundFreezetimeEnd) {
+		gs := iParser.GameState()
+		tPlayers := gs.TeamTerrorists().Members()
+		ctPlayers := gs.TeamCounterTerrorists().Members()
+		for _, player := range append(tPlayers, ctPlayers...) {
+			state.addBookmark(player, BOOKMARK_FREEZETIME_END)
+		}
+	})
+
 	iParser.RegisterEventHandler(func(e events.RoundEnd) {
 		gs := iParser.GameState()
 
@@ -245,33 +360,142 @@ func Start(filePath string) {
 		if currentRound != nil {
 			currentTick := gs.IngameTick()
 			currentRound.roundEnd = currentTick
+			currentRound.markEvent(EVENT_ROUND_END, currentTick)
 
 			ilog.InfoLogger.Printf("回合 %d 结束 (Tick: %d)", currentRound.roundNum, currentTick)
 
+			if !opts.wantRound(currentRound.roundNum) {
+				ilog.InfoLogger.Printf("  回合 %d 不在导出范围内，跳过保存", currentRound.roundNum)
+				ilog.InfoLogger.Printf("====================================\n")
+				currentRound = nil
+				return
+			}
+
+			// 录像被裁剪或保存之前写出等待中的表格行
+			if err := state.flushRows(); err != nil {
+				writeErr = err
+				iParser.Cancel()
+				return
+			}
+
+			if opts.Utility {
+				files, err := state.saveUtility(iParser.Header().MapName, iParser.TickRate(), opts.UtilityLeadTime)
+				result.Files = append(result.Files, files...)
+				if err != nil {
+					writeErr = err
+					iParser.Cancel()
+					return
+				}
+				state.enc.Discard()
+				state.players = make(map[uint64]*PlayerManifest)
+				state.departed = make(map[uint64]*common.Player)
+
+				ilog.InfoLogger.Printf("  已保存 %d 个道具片段", len(files))
+				ilog.InfoLogger.Printf("====================================\n")
+				result.Rounds = append(result.Rounds, currentRound.roundNum)
+				currentRound = nil
+				return
+			}
+
 			tPlayers := gs.TeamTerrorists().Members()
 			ctPlayers := gs.TeamCounterTerrorists().Members()
 			Players := append(tPlayers, ctPlayers...)
+			// 中途离开的玩家也需要保存
+			for key, player := range state.departed {
+				if !containsPlayer(Players, key) {
+					Players = append(Players, player)
+				}
+			}
+			// 固定保存顺序，同名玩家的文件名与 manifest 中的顺序不受 map 遍历顺序影响
+			sortPlayers(Players)
 
 			ilog.InfoLogger.Printf("  正在保存录像文件...")
 			savedCount := 0
+			roundManifest := newRoundManifest(currentRound, e, gs.TeamTerrorists().Score(), gs.TeamCounterTerrorists().Score())
+			roundManifest.Map = iParser.Header().MapName
+			roundManifest.TickRate = iParser.TickRate()
+			roundManifest.SliceFromTick, roundManifest.SliceToTick = state.sliceRecordings(currentRound, &opts, iParser.TickRate())
 
 			for _, player := range Players {
-				if player != nil {
-					saveToRecFile(player, int32(currentRound.roundNum))
-					savedCount++
+				// 离开的玩家阵营可能已经改变，只要开始录制过就保存
+				if player == nil || (!opts.wantPlayer(player) && state.departed[playerKey(player)] == nil) {
+					continue
+				}
+				fileName, err := state.saveToRecFile(player, int32(currentRound.roundNum))
+				if errors.Is(err, rec.ErrNoRecording) {
+					ilog.WarningLogger.Printf("    玩家 %s 没有录像数据，跳过保存", player.Name)
+					continue
 				}
+				if err != nil {
+					writeErr = err
+					iParser.Cancel()
+					return
+				}
+				result.Files = append(result.Files, fileName)
+				if manifest := state.players[playerKey(player)]; manifest != nil {
+					roundManifest.Players = append(roundManifest.Players, *manifest)
+				}
+				savedCount++
+			}
+			state.players = make(map[uint64]*PlayerManifest)
+			state.departed = make(map[uint64]*common.Player)
+
+			roundDir := filepath.Join(outputBaseDir, fmt.Sprintf("round%d", currentRound.roundNum))
+			if err := os.MkdirAll(roundDir, os.ModePerm); err != nil {
+				writeErr = err
+				iParser.Cancel()
+				return
 			}
+			if err := writeManifest(roundDir, roundManifest); err != nil {
+				writeErr = err
+				iParser.Cancel()
+				return
+			}
+			demoManifest.Rounds = append(demoManifest.Rounds, roundManifest)
 
 			ilog.InfoLogger.Printf("  已保存 %d 个玩家录像到: %s/round%d/", savedCount, outputBaseDir, currentRound.roundNum)
 			ilog.InfoLogger.Printf("====================================\n")
 
+			result.Rounds = append(result.Rounds, currentRound.roundNum)
 			currentRound = nil
 		}
 	})
 
 	err = iParser.ParseToEnd()
-	checkError(err)
+	if writeErr != nil {
+		return result, &DemoError{Demo: filePath, Op: "write", Err: writeErr}
+	}
+	if errors.Is(err, dem.ErrUnexpectedEndOfDemo) && len(result.Rounds) > 0 {
+		// 不完整的 demo 很常见，已经结束的回合仍然有效
+		ilog.WarningLogger.Printf("demo 不完整，解析提前结束: %s", filePath)
+	} else if err != nil {
+		return result, &DemoError{Demo: filePath, Op: "parse", Err: err}
+	}
+
+	if err := state.closeExporters(); err != nil {
+		return result, &DemoError{Demo: filePath, Op: "write", Err: err}
+	}
+	if err := state.buttons.close(); err != nil {
+		return result, &DemoError{Demo: filePath, Op: "write", Err: err}
+	}
+
+	if opts.Utility {
+		state.utility.Demo = demoName
+		state.utility.TickRate = iParser.TickRate()
+		if err := state.writeUtilityIndex(); err != nil {
+			return result, &DemoError{Demo: filePath, Op: "write", Err: err}
+		}
+		ilog.InfoLogger.Printf("\n解析完成!道具片段已保存到 %s/utility/ 目录", outputBaseDir)
+		return result, nil
+	}
+
+	demoManifest.Map = iParser.Header().MapName
+	demoManifest.TickRate = iParser.TickRate()
+	if err := writeManifest(outputBaseDir, demoManifest); err != nil {
+		return result, &DemoError{Demo: filePath, Op: "write", Err: err}
+	}
 
 	ilog.InfoLogger.Printf("\n解析完成!所有回合录像已保存到 %s/ 目录", outputBaseDir)
 	ilog.InfoLogger.Printf("共解析 %d 个回合\n", roundNum)
+	return result, nil
 }
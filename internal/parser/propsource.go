@@ -0,0 +1,284 @@
+package parser
+
+import (
+	"math"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+	st "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/sendtables"
+)
+
+// m_fFlags 中的 FL_ONGROUND
+const FL_ONGROUND = 1 << 0
+
+// propWatcher 订阅玩家实体的属性更新，按实体 ID 保存最新的值。
+// 布尔属性在两帧之间短暂变为 true 时也会被记录，直到下一次读取。
+type propWatcher struct {
+	names  []string
+	values map[int]map[string]st.PropertyValue
+	seen   map[int]map[string]bool
+}
+
+func newPropWatcher(names ...string) *propWatcher {
+	return &propWatcher{
+		names:  names,
+		values: make(map[int]map[string]st.PropertyValue),
+		seen:   make(map[int]map[string]bool),
+	}
+}
+
+// register 在数据表解析完成后订阅之后创建的每个玩家实体
+func (w *propWatcher) register(parser dem.Parser) {
+	parser.RegisterEventHandler(func(events.DataTablesParsed) {
+		class := parser.ServerClasses().FindByName("CCSPlayer")
+		if class == nil {
+			return
+		}
+		class.OnEntityCreated(func(entity st.Entity) {
+			id := entity.ID()
+			values := make(map[string]st.PropertyValue)
+			seen := make(map[string]bool)
+			w.values[id] = values
+			w.seen[id] = seen
+			for _, name := range w.names {
+				name := name
+				prop := entity.Property(name)
+				if prop == nil {
+					continue
+				}
+				prop.OnUpdate(func(val st.PropertyValue) {
+					values[name] = val
+					if val.IntVal > 0 {
+						seen[name] = true
+					}
+				})
+			}
+		})
+	})
+}
+
+// value 返回玩家实体属性的最新值
+func (w *propWatcher) value(player *common.Player, name string) (st.PropertyValue, bool) {
+	if player.Entity == nil {
+		return st.PropertyValue{}, false
+	}
+	val, ok := w.values[player.Entity.ID()][name]
+	return val, ok
+}
+
+// pressed 返回布尔属性当前或上一次读取之后是否为 true
+func (w *propWatcher) pressed(player *common.Player, name string) bool {
+	if player.Entity == nil {
+		return false
+	}
+	seen := w.seen[player.Entity.ID()]
+	val := w.values[player.Entity.ID()][name]
+	if val.IntVal > 0 || seen[name] {
+		delete(seen, name)
+		return true
+	}
+	return false
+}
+
+// useSource 拆包或救人质时按住 IN_USE
+type useSource struct {
+	props *propWatcher
+}
+
+func newUseSource() ButtonSource {
+	return &useSource{props: newPropWatcher("m_bIsDefusing", "m_bIsGrabbingHostage")}
+}
+
+func (s *useSource) Register(parser dem.Parser) {
+	s.props.register(parser)
+}
+
+func (s *useSource) Buttons(player *common.Player, tick int) int32 {
+	// 两个属性都要读取，清除各自的记录
+	defusing := s.props.pressed(player, "m_bIsDefusing")
+	grabbing := s.props.pressed(player, "m_bIsGrabbingHostage")
+	if defusing || grabbing {
+		return IN_USE
+	}
+	return 0
+}
+
+func (s *useSource) Reset() {}
+
+// duckSource 根据 m_flDuckAmount 的变化判断下蹲键：
+// 蹲下过程中按住，起身过程中已经松开，不变时以 FL_ANIMDUCKING 与是否完全蹲下为准。
+// 比只看 FL_ANIMDUCKING 更早按下、更早松开，与实际按键的时机一致。
+type duckSource struct {
+	props      *propWatcher
+	lastAmount map[uint64]float32
+}
+
+func newDuckSource() ButtonSource {
+	return &duckSource{props: newPropWatcher("m_flDuckAmount")}
+}
+
+func (s *duckSource) Register(parser dem.Parser) {
+	s.props.register(parser)
+}
+
+func (s *duckSource) Buttons(player *common.Player, tick int) int32 {
+	amount, ok := s.props.value(player, "m_flDuckAmount")
+	if !ok {
+		if player.Flags().DuckingKeyPressed() {
+			return IN_DUCK
+		}
+		return 0
+	}
+	if s.lastAmount == nil {
+		s.lastAmount = make(map[uint64]float32)
+	}
+	key := playerKey(player)
+	last, exists := s.lastAmount[key]
+	s.lastAmount[key] = amount.FloatVal
+	switch {
+	case exists && amount.FloatVal > last:
+		return IN_DUCK
+	case exists && amount.FloatVal < last:
+		return 0
+	case amount.FloatVal >= 1 || player.Flags().DuckingKeyPressed():
+		return IN_DUCK
+	}
+	return 0
+}
+
+func (s *duckSource) Reset() {
+	s.lastAmount = nil
+}
+
+// spraySource 根据 m_iShotsFired 判断开火键是否按住：开火时增加，松开后逐渐减少到 0。
+// 只用于全自动武器，每次增加按一次开火处理，按住的时长由 fireSource 决定，
+// 停止射击时在下一发子弹之前松开；半自动武器与点射模式每次开火都要重新按下，按住会导致回放时少开枪。
+type spraySource struct {
+	parser    dem.Parser
+	props     *propWatcher
+	lastShots map[uint64]int
+	fire      fireSource
+}
+
+func newSpraySource() ButtonSource {
+	return &spraySource{props: newPropWatcher("m_iShotsFired")}
+}
+
+func (s *spraySource) Register(parser dem.Parser) {
+	s.parser = parser
+	s.props.register(parser)
+}
+
+func (s *spraySource) Buttons(player *common.Player, tick int) int32 {
+	shots, ok := s.props.value(player, "m_iShotsFired")
+	if !ok {
+		return 0
+	}
+	if s.lastShots == nil {
+		s.lastShots = make(map[uint64]int)
+	}
+	key := playerKey(player)
+	last, exists := s.lastShots[key]
+	s.lastShots[key] = shots.IntVal
+	if !exists || shots.IntVal <= 0 || shots.IntVal < last {
+		delete(s.fire.shots, key)
+		return 0
+	}
+	mode := weaponFireMode(player.ActiveWeapon())
+	if !mode.automatic {
+		return 0
+	}
+	if shots.IntVal > last {
+		s.fire.fire(key, tick, mode, s.parser.TickRate())
+	}
+	return s.fire.Buttons(player, tick)
+}
+
+func (s *spraySource) Reset() {
+	s.lastShots = nil
+	s.fire.Reset()
+}
+
+// airborneSource 离开地面且向上运动的一帧按下 IN_JUMP，补上没有 player_jump 事件的起跳
+type airborneSource struct {
+	props    *propWatcher
+	onGround map[uint64]bool
+}
+
+func newAirborneSource() ButtonSource {
+	return &airborneSource{props: newPropWatcher("m_fFlags")}
+}
+
+func (s *airborneSource) Register(parser dem.Parser) {
+	s.props.register(parser)
+}
+
+func (s *airborneSource) Buttons(player *common.Player, tick int) int32 {
+	flags, ok := s.props.value(player, "m_fFlags")
+	if !ok {
+		return 0
+	}
+	if s.onGround == nil {
+		s.onGround = make(map[uint64]bool)
+	}
+	key := playerKey(player)
+	onGround := flags.IntVal&FL_ONGROUND != 0
+	wasOnGround, exists := s.onGround[key]
+	s.onGround[key] = onGround
+	if exists && wasOnGround && !onGround && player.Velocity().Z > 0 {
+		return IN_JUMP
+	}
+	return 0
+}
+
+func (s *airborneSource) Reset() {
+	s.onGround = nil
+}
+
+// ladderSource 在梯子上时根据速度与视角给出移动键。
+// 梯子上按前进键沿视角方向爬行，向下看时前进键向下爬，
+// 无法从水平速度推断，inferMovement 不会覆盖这些按键。
+type ladderSource struct {
+	props *propWatcher
+}
+
+func newLadderSource() ButtonSource {
+	return &ladderSource{props: newPropWatcher("movetype")}
+}
+
+func (s *ladderSource) Register(parser dem.Parser) {
+	s.props.register(parser)
+}
+
+func (s *ladderSource) Buttons(player *common.Player, tick int) int32 {
+	moveType, ok := s.props.value(player, "movetype")
+	if !ok || moveType.IntVal != MOVETYPE_LADDER {
+		return 0
+	}
+	velocity := player.Velocity()
+	pitch := float64(player.ViewDirectionY())
+	if pitch > 180 {
+		pitch -= 360
+	}
+	var buttons int32
+	if math.Abs(velocity.Z) >= minMoveSpeed {
+		// 向上看时前进键向上爬
+		if (velocity.Z > 0) == (pitch <= 0) {
+			buttons |= IN_FORWARD
+		} else {
+			buttons |= IN_BACK
+		}
+	}
+	if math.Hypot(velocity.X, velocity.Y) >= minMoveSpeed {
+		side := quantizeMovement(velocity.X, velocity.Y, float64(player.ViewDirectionX())).side
+		if side < 0 {
+			buttons |= IN_MOVELEFT
+		} else if side > 0 {
+			buttons |= IN_MOVERIGHT
+		}
+	}
+	return buttons
+}
+
+func (s *ladderSource) Reset() {}
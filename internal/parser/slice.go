@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ilog "github.com/dxldb/minidemo-encoder/internal/logger"
+)
+
+// 回合事件名称，用于相对事件切片
+const (
+	EVENT_ROUND_START    = "round_start"
+	EVENT_FREEZETIME_END = "freezetime_end"
+	EVENT_FIRST_SHOT     = "first_shot"
+	EVENT_FIRST_KILL     = "first_kill"
+	EVENT_BOMB_PLANT     = "bomb_plant"
+	EVENT_BOMB_DEFUSE    = "bomb_defuse"
+	EVENT_ROUND_END      = "round_end"
+)
+
+// TickBound 切片的一端：固定的 tick，或相对某个事件偏移若干秒
+type TickBound struct {
+	// Event 为空时使用
+	Tick int
+	// 事件名，解析 demo 时为回合事件，处理 .rec 文件时为书签名
+	Event string
+	// 相对事件的偏移
+	Offset time.Duration
+}
+
+// ParseTickBound 解析 "12345"、"first_kill"、"first_kill-10s"、"bomb_plant+2.5s" 形式的切片边界
+func ParseTickBound(s string) (*TickBound, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if tick, err := strconv.Atoi(s); err == nil {
+		if tick < 0 {
+			return nil, fmt.Errorf("非法的切片边界 %q", s)
+		}
+		return &TickBound{Tick: tick}, nil
+	}
+	bound := &TickBound{Event: s}
+	// 后缀不是合法的时长时整体视为事件名，书签名中可能带有 "-"
+	if idx := strings.LastIndexAny(s, "+-"); idx > 0 {
+		if offset, err := time.ParseDuration(s[idx:]); err == nil {
+			bound.Event, bound.Offset = s[:idx], offset
+		}
+	}
+	return bound, nil
+}
+
+func (b *TickBound) String() string {
+	if b.Event == "" {
+		return strconv.Itoa(b.Tick)
+	}
+	if b.Offset < 0 {
+		return b.Event + b.Offset.String()
+	}
+	if b.Offset > 0 {
+		return b.Event + "+" + b.Offset.String()
+	}
+	return b.Event
+}
+
+// Resolve 根据事件位置与 tickrate 计算边界对应的 tick，事件没有发生时返回 false
+func (b *TickBound) Resolve(events map[string]int, tickrate float64) (int, bool) {
+	if b.Event == "" {
+		return b.Tick, true
+	}
+	tick, ok := events[b.Event]
+	if !ok {
+		return 0, false
+	}
+	return tick + int(b.Offset.Seconds()*tickrate), true
+}
+
+// markEvent 记录事件在本回合第一次发生的 tick
+func (round *RoundInfo) markEvent(name string, tick int) {
+	if round == nil {
+		return
+	}
+	if round.events == nil {
+		round.events = make(map[string]int)
+	}
+	if _, ok := round.events[name]; !ok {
+		round.events[name] = tick
+	}
+}
+
+// sliceRecordings 按 opts.From / opts.To 裁剪本回合所有玩家的录像，返回实际使用的 tick 范围 (0 表示不限)
+func (s *demoState) sliceRecordings(round *RoundInfo, opts *Options, tickrate float64) (int, int) {
+	if opts.From == nil && opts.To == nil {
+		return 0, 0
+	}
+	fromTick, toTick := 0, 0
+	if opts.From != nil {
+		if tick, ok := opts.From.Resolve(round.events, tickrate); ok {
+			fromTick = tick
+		} else {
+			ilog.WarningLogger.Printf("  回合 %d 没有发生事件 %s，从头开始保存", round.roundNum, opts.From.Event)
+		}
+	}
+	if opts.To != nil {
+		if tick, ok := opts.To.Resolve(round.events, tickrate); ok {
+			toTick = tick
+		} else {
+			ilog.WarningLogger.Printf("  回合 %d 没有发生事件 %s，保存到回合结束", round.roundNum, opts.To.Event)
+		}
+	}
+
+	keys := make([]uint64, 0, len(s.frameTicks))
+	for key := range s.frameTicks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, key := range keys {
+		recording := s.enc.Recording(key)
+		if recording == nil {
+			continue
+		}
+		ticks := s.frameTicks[key]
+		start := sort.SearchInts(ticks, fromTick)
+		end := len(ticks)
+		if toTick > 0 {
+			end = sort.SearchInts(ticks, toTick+1)
+		}
+		if start >= end {
+			// 切片范围内没有该玩家的帧
+			s.enc.SetRecording(key, nil)
+			continue
+		}
+		s.enc.SetRecording(key, recording.Slice(start, end))
+	}
+	return fromTick, toTick
+}
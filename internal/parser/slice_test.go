@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTickBound(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *TickBound
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  ", nil, false},
+		{"12345", &TickBound{Tick: 12345}, false},
+		{"first_kill", &TickBound{Event: "first_kill"}, false},
+		{"first_kill-10s", &TickBound{Event: "first_kill", Offset: -10 * time.Second}, false},
+		{"bomb_plant+2.5s", &TickBound{Event: "bomb_plant", Offset: 2500 * time.Millisecond}, false},
+		// 后缀不是合法的时长时整体视为事件名
+		{"kill s1mple-x", &TickBound{Event: "kill s1mple-x"}, false},
+		{"first_kill-10", &TickBound{Event: "first_kill-10"}, false},
+		{"-5", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTickBound(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTickBound(%q) 错误 %v, 期望出错 %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTickBound(%q) = %+v, 期望 %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTickBoundResolve(t *testing.T) {
+	events := map[string]int{EVENT_FIRST_KILL: 1000, EVENT_BOMB_PLANT: 2000}
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"500", 500, true},
+		{"first_kill-10s", 360, true},
+		{"bomb_plant+2.5s", 2160, true},
+		{"bomb_defuse", 0, false},
+	}
+	for _, tt := range tests {
+		bound, err := ParseTickBound(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := bound.Resolve(events, 64); got != tt.want || ok != tt.ok {
+			t.Errorf("%q: Resolve = %d, %v, 期望 %d, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+		if again, _ := ParseTickBound(bound.String()); !reflect.DeepEqual(again, bound) {
+			t.Errorf("%q: String() = %q 无法解析回相同的边界", tt.in, bound.String())
+		}
+	}
+}
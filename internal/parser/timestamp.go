@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 录像文件头时间戳的来源
+const (
+	TIMESTAMP_WALL  = "wall"
+	TIMESTAMP_DEMO  = "demo"
+	TIMESTAMP_FIXED = "fixed"
+)
+
+// "demo" 使用的固定时间戳 (unix 0)，inspect 显示为未记录
+const DEMO_EPOCH = 0
+
+// TimestampSource 决定录像文件头中的时间戳。
+// demo 文件头中没有录制时间，"demo" 写入固定的 DEMO_EPOCH，不伪造录制日期；
+// 需要输出逐字节可复现时使用 "demo" 或 "fixed"。
+type TimestampSource struct {
+	// "wall" (默认)、"demo" 或 "fixed"
+	Mode  string
+	Fixed time.Time
+}
+
+// ParseTimestampSource 解析 "wall"、"demo"、unix 秒数或 RFC3339 时间
+func ParseTimestampSource(s string) (TimestampSource, error) {
+	switch s {
+	case "", TIMESTAMP_WALL:
+		return TimestampSource{Mode: TIMESTAMP_WALL}, nil
+	case TIMESTAMP_DEMO:
+		return TimestampSource{Mode: TIMESTAMP_DEMO}, nil
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return TimestampSource{Mode: TIMESTAMP_FIXED, Fixed: time.Unix(seconds, 0)}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return TimestampSource{Mode: TIMESTAMP_FIXED, Fixed: t}, nil
+	}
+	return TimestampSource{}, fmt.Errorf("非法的时间戳 %q, 可以是 wall、demo、unix秒数或RFC3339时间", s)
+}
+
+// clock 返回解析 demo 时使用的时间来源
+func (ts TimestampSource) clock() (func() time.Time, error) {
+	switch ts.Mode {
+	case "", TIMESTAMP_WALL:
+		return time.Now, nil
+	case TIMESTAMP_DEMO:
+		return func() time.Time { return time.Unix(DEMO_EPOCH, 0) }, nil
+	case TIMESTAMP_FIXED:
+		fixed := ts.Fixed
+		return func() time.Time { return fixed }, nil
+	}
+	return nil, fmt.Errorf("未知的时间戳来源 %q", ts.Mode)
+}
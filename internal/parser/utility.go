@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+const utilityIndexFileName = "index.json"
+
+// 投掷时水平速度超过该值视为跑投 (静步速度约为 130)
+const runThrowSpeed = 135.0
+
+// UtilityThrow 单个道具投掷片段
+type UtilityThrow struct {
+	Round   int    `json:"round"`
+	SteamID uint64 `json:"steamid,string"`
+	Name    string `json:"name"`
+	Side    string `json:"side"`
+	Grenade string `json:"grenade"`
+	// 相对 demo 输出目录的路径
+	File   string `json:"file"`
+	Frames int    `json:"frames"`
+	// 片段内松开投掷键的帧
+	ThrowFrame int `json:"throw_frame"`
+	ThrowTick  int `json:"throw_tick"`
+	// 道具落地 (起爆) 的 tick，回合结束时仍未落地为 0
+	LandTick int `json:"land_tick"`
+	// 投掷时的位置与视角 (pitch, yaw)
+	Position [3]float32 `json:"position"`
+	Angles   [2]float32 `json:"angles"`
+	Landing  [3]float32 `json:"landing"`
+	// 投掷使用的按键："attack"、"attack2" 或 "attack+attack2"
+	Button    string `json:"button"`
+	JumpThrow bool   `json:"jump_throw"`
+	RunThrow  bool   `json:"run_throw"`
+
+	key        uint64
+	throwFrame int
+	landFrame  int
+}
+
+// UtilityIndex 道具片段索引，按 地图 -> 阵营 -> 道具类型 分组
+type UtilityIndex struct {
+	Demo     string                                          `json:"demo"`
+	TickRate float64                                         `json:"tick_rate"`
+	Maps     map[string]map[string]map[string][]UtilityThrow `json:"maps"`
+}
+
+var grenadeTypeNames = map[common.EquipmentType]string{
+	common.EqSmoke:      "smoke",
+	common.EqFlash:      "flash",
+	common.EqHE:         "he",
+	common.EqMolotov:    "molotov",
+	common.EqIncendiary: "incendiary",
+	common.EqDecoy:      "decoy",
+}
+
+// throwButton 根据松开前一帧按住的键判断投掷方式
+func throwButton(buttons int32) string {
+	switch buttons & (IN_ATTACK | IN_ATTACK2) {
+	case IN_ATTACK | IN_ATTACK2:
+		return "attack+attack2"
+	case IN_ATTACK2:
+		return "attack2"
+	}
+	return "attack"
+}
+
+// trackThrow 记录道具投掷，等待落地后截取片段
+func (s *demoState) trackThrow(projectile *common.GrenadeProjectile, round, tick int) {
+	if projectile == nil || projectile.Thrower == nil || projectile.WeaponInstance == nil || projectile.Entity == nil {
+		return
+	}
+	grenade, ok := grenadeTypeNames[projectile.WeaponInstance.Type]
+	if !ok {
+		return
+	}
+	thrower := projectile.Thrower
+	key := playerKey(thrower)
+	recording := s.enc.Recording(key)
+	if recording == nil || len(recording.Frames) == 0 {
+		return
+	}
+	last := &recording.Frames[len(recording.Frames)-1]
+	velocity := thrower.Velocity()
+	s.throws[projectile.Entity.ID()] = &UtilityThrow{
+		Round:      round,
+		SteamID:    thrower.SteamID64,
+		Name:       thrower.Name,
+		Side:       teamSideName(thrower.Team),
+		Grenade:    grenade,
+		ThrowTick:  tick,
+		Position:   [3]float32{float32(thrower.Position().X), float32(thrower.Position().Y), float32(thrower.Position().Z)},
+		Angles:     [2]float32{thrower.ViewDirectionY(), thrower.ViewDirectionX()},
+		Button:     throwButton(last.PlayerButtons),
+		JumpThrow:  thrower.IsAirborne(),
+		RunThrow:   math.Hypot(velocity.X, velocity.Y) > runThrowSpeed,
+		key:        key,
+		throwFrame: recording.FrameCount(),
+		landFrame:  -1,
+	}
+}
+
+// landThrow 记录道具的落地位置，同一个道具只记录第一次
+func (s *demoState) landThrow(entityID int, landing [3]float32, tick int) {
+	throw := s.throws[entityID]
+	if throw == nil || throw.landFrame >= 0 {
+		return
+	}
+	throw.LandTick = tick
+	throw.Landing = landing
+	throw.landFrame = throw.throwFrame
+	if recording := s.enc.Recording(throw.key); recording != nil {
+		throw.landFrame = recording.FrameCount()
+	}
+	s.done = append(s.done, throw)
+	delete(s.throws, entityID)
+}
+
+// saveUtility 截取本回合所有道具片段并写入 <saveDir>/utility/<地图>/<阵营>/<道具>/，
+// leadTime 为投掷前保留的秒数
+func (s *demoState) saveUtility(mapName string, tickrate, leadTime float64) ([]string, error) {
+	// 回合结束时仍未落地的道具截取到最后一帧
+	for _, throw := range s.throws {
+		if recording := s.enc.Recording(throw.key); recording != nil {
+			throw.landFrame = recording.FrameCount() - 1
+		}
+		s.done = append(s.done, throw)
+	}
+	s.throws = make(map[int]*UtilityThrow)
+
+	// 回合结束时才截取的道具来自 map，按投掷顺序排列保证输出稳定
+	sort.SliceStable(s.done, func(i, j int) bool {
+		if s.done[i].ThrowTick != s.done[j].ThrowTick {
+			return s.done[i].ThrowTick < s.done[j].ThrowTick
+		}
+		return s.done[i].key < s.done[j].key
+	})
+	var files []string
+	for _, throw := range s.done {
+		recording := s.enc.Recording(throw.key)
+		if recording == nil {
+			continue
+		}
+		start := throw.throwFrame - int(leadTime*tickrate)
+		if start < 0 {
+			start = 0
+		}
+		clip := recording.Slice(start, throw.landFrame+1)
+		throw.Frames = len(clip.Frames)
+		throw.ThrowFrame = throw.throwFrame - start
+
+		side := throw.Side
+		if side == "" {
+			side = "unknown"
+		}
+		dir := filepath.Join(s.enc.SaveDir(), "utility", rec.SanitizeFileName(mapName), side, throw.Grenade)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return files, &rec.WriteError{Path: dir, Err: err}
+		}
+		// 同名玩家在同一 tick 投掷时文件名追加 SteamID64
+		fileName := s.enc.UniqueFilePath(dir, fmt.Sprintf("r%d_%s_%d", throw.Round, rec.SanitizeFileName(throw.Name), throw.ThrowTick), throw.key)
+		if err := clip.WriteFile(fileName); err != nil {
+			return files, err
+		}
+		throw.File, _ = filepath.Rel(s.enc.SaveDir(), fileName)
+		throw.File = filepath.ToSlash(throw.File)
+		files = append(files, fileName)
+
+		if s.utility.Maps[mapName] == nil {
+			s.utility.Maps[mapName] = make(map[string]map[string][]UtilityThrow)
+		}
+		if s.utility.Maps[mapName][side] == nil {
+			s.utility.Maps[mapName][side] = make(map[string][]UtilityThrow)
+		}
+		s.utility.Maps[mapName][side][throw.Grenade] = append(s.utility.Maps[mapName][side][throw.Grenade], *throw)
+	}
+	s.done = nil
+	return files, nil
+}
+
+// writeUtilityIndex 写入 <saveDir>/utility/index.json
+func (s *demoState) writeUtilityIndex() error {
+	dir := filepath.Join(s.enc.SaveDir(), "utility")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.utility, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, utilityIndexFileName), data, 0644)
+}
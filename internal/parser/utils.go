@@ -1,26 +1,84 @@
 package parser
 
 import (
-	"math"
+	"path/filepath"
+	"strings"
 
-	encoder "github.com/dxldb/minidemo-encoder/internal/encoder"
 	ilog "github.com/dxldb/minidemo-encoder/internal/logger"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
 	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 )
 
 const Pi = 3.14159265358979323846
 
-var bufWeaponMap map[string]int32 = make(map[string]int32)
-var playerLastZ map[string]float32 = make(map[string]float32)
-// Function to handle errors
-func checkError(err error) {
-	if err != nil {
-		ilog.ErrorLogger.Println(err.Error())
+// demoState 保存解析单个 demo 时的玩家状态，不同 demo 之间互不影响
+type demoState struct {
+	enc          *rec.Encoder
+	bufWeaponMap map[uint64]int32
+	playerLastZ  map[uint64]float32
+	playerFired  map[uint64]bool
+	// 当前回合已开始录制的玩家，用于生成 manifest
+	players map[uint64]*PlayerManifest
+
+	newKeyframes KeyframeStrategyFactory
+	keyframes    map[uint64]KeyframeStrategy
+
+	buttons *buttonPipeline
+	// 已经提示过无法流式写出
+	spoolWarned bool
+
+	// 每一帧对应的 tick，用于按 tick 切片，流式写出时只保留最后一帧；tick 为当前处理的 tick
+	frameTicks map[uint64][]int
+	tick       int
+
+	// 已死亡或离开、暂停录制的玩家
+	finished map[uint64]bool
+	// 当前回合中途离开的玩家
+	departed map[uint64]*common.Player
+
+	// 表格导出
+	exporters []TickWriter
+	pending   map[uint64]*pendingRow
+
+	// 道具模式：飞行中的道具 (以实体 ID 区分)、本回合已落地的道具与所有导出的片段
+	throws  map[int]*UtilityThrow
+	done    []*UtilityThrow
+	utility UtilityIndex
+}
+
+func newDemoState(enc *rec.Encoder, newKeyframes KeyframeStrategyFactory) *demoState {
+	if newKeyframes == nil {
+		newKeyframes = NewFixedKeyframes
+	}
+	return &demoState{
+		enc:          enc,
+		bufWeaponMap: make(map[uint64]int32),
+		playerLastZ:  make(map[uint64]float32),
+		playerFired:  make(map[uint64]bool),
+		players:      make(map[uint64]*PlayerManifest),
+		newKeyframes: newKeyframes,
+		keyframes:    make(map[uint64]KeyframeStrategy),
+		frameTicks:   make(map[uint64][]int),
+		finished:     make(map[uint64]bool),
+		departed:     make(map[uint64]*common.Player),
+		pending:      make(map[uint64]*pendingRow),
+		throws:       make(map[int]*UtilityThrow),
+		utility:      UtilityIndex{Maps: make(map[string]map[string]map[string][]UtilityThrow)},
+	}
+}
+
+// playerKey 返回区分玩家的键。
+// 真实玩家使用 SteamID64；bot 的 SteamID64 都为 0，改用 UserID，
+// UserID 远小于任何有效的 SteamID64，不会与真实玩家冲突。
+func playerKey(player *common.Player) uint64 {
+	if player.SteamID64 == 0 {
+		return uint64(player.UserID)
 	}
+	return player.SteamID64
 }
 
-func parsePlayerInitFrame(player *common.Player) {
-	iFrameInit := encoder.FrameInitInfo{
+func (s *demoState) parsePlayerInitFrame(player *common.Player) {
+	iFrameInit := rec.FrameInitInfo{
 		PlayerName: player.Name,
 	}
 	iFrameInit.Position[0] = float32(player.Position().X)
@@ -29,10 +87,25 @@ func parsePlayerInitFrame(player *common.Player) {
 	iFrameInit.Angles[0] = float32(player.ViewDirectionY())
 	iFrameInit.Angles[1] = float32(player.ViewDirectionX())
 
-	encoder.InitPlayer(iFrameInit)
-	delete(bufWeaponMap, player.Name)
-	delete(encoder.PlayerFramesMap, player.Name)
-	playerLastZ[player.Name] = float32(player.Position().Z)
+	key := playerKey(player)
+	s.enc.InitPlayer(key, iFrameInit)
+	if err := s.enc.StreamError(); err != nil && !s.spoolWarned {
+		ilog.WarningLogger.Printf("无法创建临时文件, 录像将全部保存在内存中: %s", err)
+		s.spoolWarned = true
+	}
+	delete(s.bufWeaponMap, key)
+	delete(s.playerFired, key)
+	s.keyframes[key] = s.newKeyframes()
+	delete(s.finished, key)
+	delete(s.departed, key)
+	s.frameTicks[key] = nil
+	s.players[key] = &PlayerManifest{
+		SteamID: player.SteamID64,
+		Name:    player.Name,
+		Team:    teamSideName(player.Team),
+		Loadout: playerLoadout(player),
+	}
+	s.playerLastZ[key] = float32(player.Position().Z)
 }
 
 func normalizeDegree(degree float64) float64 {
@@ -47,16 +120,24 @@ func radian2degree(radian float64) float64 {
 	return normalizeDegree(radian * 180 / Pi)
 }
 
-func parsePlayerFrame(player *common.Player, addonButton int32, tickrate float64, fullsnap bool) {
+func (s *demoState) parsePlayerFrame(player *common.Player, tickrate float64, fullsnap bool) {
 	if !player.IsAlive() {
 		return
 	}
-	iFrameInfo := new(encoder.FrameInfo)
+	// 玩家还没有开始录制（冻结时间内或未被选中）时跳过
+	key := playerKey(player)
+	recording := s.enc.Recording(key)
+	if recording == nil {
+		return
+	}
+	respawned := s.resumePlayer(player)
+	iFrameInfo := new(rec.FrameInfo)
 		// ----- button encode
-	iFrameInfo.PlayerButtons = ButtonConvert(player, addonButton)
+	iFrameInfo.PlayerButtons = s.buttons.collect(player, s.tick)
 	iFrameInfo.PlayerImpulse = 0
-	iFrameInfo.PredictedVelocity[0] = 0.0
-	iFrameInfo.PredictedVelocity[1] = 0.0
+	input := buttonMovement(iFrameInfo.PlayerButtons)
+	iFrameInfo.PredictedVelocity[0] = input.forward
+	iFrameInfo.PredictedVelocity[1] = input.side
 	iFrameInfo.PredictedVelocity[2] = 0.0
 	iFrameInfo.CSWeaponID = int32(CSWeapon_NONE)
 	iFrameInfo.PlayerSubtype = 0
@@ -70,88 +151,119 @@ func parsePlayerFrame(player *common.Player, addonButton int32, tickrate float64
 	iFrameInfo.ActualVelocity[1] = float32(player.Velocity().Y)
 	iFrameInfo.ActualVelocity[2] = float32(player.Velocity().Z)
 
-	lastIdx := len(encoder.PlayerFramesMap[player.Name]) - 1
-	// addons
-	if fullsnap || (lastIdx+1)%int(tickrate*2) == 0 {
-		iFrameInfo.AdditionalFields |= encoder.FIELDS_ORIGIN
-		iFrameInfo.AtOrigin[0] = float32(player.Position().X)
-		iFrameInfo.AtOrigin[1] = float32(player.Position().Y)
-		iFrameInfo.AtOrigin[2] = float32(player.Position().Z)
-		iFrameInfo.AdditionalFields |= encoder.FIELDS_VELOCITY
-		iFrameInfo.AtVelocity[0] = float32(player.Velocity().X)
-		iFrameInfo.AtVelocity[1] = float32(player.Velocity().Y)
-		iFrameInfo.AtVelocity[2] = float32(player.Velocity().Z)
-	}
+	lastIdx := len(recording.Frames) - 1
 	// record Z velocity
-	deltaZ := float32(player.Position().Z) - playerLastZ[player.Name]
-	playerLastZ[player.Name] = float32(player.Position().Z)
+	deltaZ := float32(player.Position().Z) - s.playerLastZ[key]
+	s.playerLastZ[key] = float32(player.Position().Z)
 
 	// velocity in Z direction need to be recorded specially
 	iFrameInfo.ActualVelocity[2] = deltaZ * float32(tickrate)
-	// Since I don't know how to get player's button bits in a tick frame,
-	// I have to use *actual vels* and *angles* to generate *predicted vels* approximately
-	// This will cause some error, but it's not a big deal
-	if lastIdx >= 0 { // not first frame
-		// We assume that actual velocity in tick N
-		// is influenced by predicted velocity in tick N-1
-		_preVel := &encoder.PlayerFramesMap[player.Name][lastIdx].PredictedVelocity
-
-		// PV = 0.0 when AV(tick N-1) = 0.0 and AV(tick N) = 0.0 ?
-		// Note: AV=Actual Velocity, PV=Predicted Velocity
-		if !(iFrameInfo.ActualVelocity[0] == 0.0 &&
-			iFrameInfo.ActualVelocity[1] == 0.0 &&
-			encoder.PlayerFramesMap[player.Name][lastIdx].ActualVelocity[0] == 0.0 &&
-			encoder.PlayerFramesMap[player.Name][lastIdx].ActualVelocity[1] == 0.0) {
-			var velAngle float64 = 0.0
-			if iFrameInfo.ActualVelocity[0] == 0.0 {
-				if iFrameInfo.ActualVelocity[1] < 0.0 {
-					velAngle = 270.0
-				} else {
-					velAngle = 90.0
-				}
-			} else {
-				velAngle = radian2degree(math.Atan2(float64(iFrameInfo.ActualVelocity[1]), float64(iFrameInfo.ActualVelocity[0])))
-			}
-			faceFront := normalizeDegree(float64(iFrameInfo.PredictedAngles[1]))
-			deltaAngle := normalizeDegree(velAngle - faceFront)
-
-			const threshold = 30.0
-			if 0.0+threshold < deltaAngle && deltaAngle < 180.0-threshold {
-				_preVel[1] = -450.0 // left
-			}
-			if 90.0+threshold < deltaAngle && deltaAngle < 270.0-threshold {
-				_preVel[0] = -450.0 // back
-			}
-			if 180.0+threshold < deltaAngle && deltaAngle < 360.0-threshold {
-				_preVel[1] = 450.0 // right
-			}
-			if 270.0+threshold < deltaAngle || deltaAngle < 90.0-threshold {
-				_preVel[0] = 450.0 // front
-			}
-		}
-
+	// We assume that actual velocity in tick N
+	// is influenced by predicted velocity and buttons in tick N-1
+	// 按键来源已经给出移动键的帧 (例如梯子上) 不再推断
+	var inferred int32
+	if lastIdx >= 0 && !respawned && s.buttons.movement && recording.Frames[lastIdx].PlayerButtons&movementButtons == 0 { // not first frame
+		input := inferMovement(recording.Frames, lastIdx, iFrameInfo, tickrate, player.IsAirborne())
+		applyMovement(&recording.Frames[lastIdx], input)
+		inferred = input.buttons()
+	}
+	if lastIdx >= 0 {
+		s.buttons.settle(player, &recording.Frames[lastIdx], inferred)
+	} else {
+		s.buttons.settle(player, nil, 0)
 	}
 	// ---- weapon encode
 	var currWeaponID int32 = 0
 	if player.ActiveWeapon() != nil {
 		currWeaponID = int32(WeaponStr2ID(player.ActiveWeapon().String()))
 	}
-	if len(encoder.PlayerFramesMap[player.Name]) == 0 {
+	if recording.FrameCount() == 0 {
 		iFrameInfo.CSWeaponID = currWeaponID
-		bufWeaponMap[player.Name] = currWeaponID
-	} else if currWeaponID == bufWeaponMap[player.Name] {
+		s.bufWeaponMap[key] = currWeaponID
+	} else if currWeaponID == s.bufWeaponMap[key] {
 		iFrameInfo.CSWeaponID = int32(CSWeapon_NONE)
 	} else {
 		iFrameInfo.CSWeaponID = currWeaponID
-		bufWeaponMap[player.Name] = currWeaponID
+		s.bufWeaponMap[key] = currWeaponID
+	}
+	// ---- keyframe encode
+	ctx := FrameContext{
+		TickRate:   tickrate,
+		FrameIndex: recording.FrameCount(),
+		FullSnap:   fullsnap || respawned,
+		Airborne:   player.IsAirborne(),
+		OnLadder:   playerOnLadder(player),
 	}
-	encoder.PlayerFramesMap[player.Name] = append(encoder.PlayerFramesMap[player.Name], *iFrameInfo)
+	if s.keyframes[key].IsKeyframe(recording.Frames, iFrameInfo, ctx) {
+		iFrameInfo.AdditionalFields |= rec.FIELDS_ORIGIN
+		iFrameInfo.AtOrigin[0] = float32(player.Position().X)
+		iFrameInfo.AtOrigin[1] = float32(player.Position().Y)
+		iFrameInfo.AtOrigin[2] = float32(player.Position().Z)
+		iFrameInfo.AdditionalFields |= rec.FIELDS_VELOCITY
+		iFrameInfo.AtVelocity[0] = float32(player.Velocity().X)
+		iFrameInfo.AtVelocity[1] = float32(player.Velocity().Y)
+		iFrameInfo.AtVelocity[2] = float32(player.Velocity().Z)
+	}
+	// 位置关键帧同时同步视角，甩枪时单独同步视角
+	if iFrameInfo.AdditionalFields&rec.FIELDS_ORIGIN != 0 ||
+		(lastIdx >= 0 && !respawned && isViewFlick(&recording.Frames[lastIdx], iFrameInfo)) {
+		iFrameInfo.AdditionalFields |= rec.FIELDS_ANGLES
+		iFrameInfo.AtAngles = keyframeAngles(iFrameInfo)
+	}
+	s.addFrame(key, recording, *iFrameInfo)
 }
 
-func saveToRecFile(player *common.Player, roundNum int32) {
-	if player.Team == common.TeamTerrorists {
-		encoder.WriteToRecFile(player.Name, roundNum, "t")
-	} else {
-		encoder.WriteToRecFile(player.Name, roundNum, "ct")
+// addFrame 追加一帧并记录其 tick
+func (s *demoState) addFrame(key uint64, recording *rec.Recording, frame rec.FrameInfo) {
+	recording.AddFrame(frame)
+	if recording.Streaming() {
+		// 流式写出时不会切片，只有表格导出需要最后一帧的 tick
+		s.frameTicks[key] = append(s.frameTicks[key][:0], s.tick)
+		return
+	}
+	s.frameTicks[key] = append(s.frameTicks[key], s.tick)
+}
+
+// saveToRecFile 保存玩家录像，返回写出的文件路径
+func (s *demoState) saveToRecFile(player *common.Player, roundNum int32) (string, error) {
+	key := playerKey(player)
+	manifest := s.players[key]
+	// 离开服务器的玩家使用开始录制时的阵营
+	teamSide := teamSideName(player.Team)
+	if teamSide == "" && manifest != nil {
+		teamSide = manifest.Team
+	}
+	if teamSide == "" {
+		teamSide = "ct"
+	}
+	teamName := strings.ToUpper(teamSide)
+	recording := s.enc.Recording(key)
+	if recording == nil {
+		return "", &rec.NoRecordingError{SteamID: key}
+	}
+	// 写出后临时文件会被删除，帧数需要在写出之前读取
+	frames := recording.FrameCount()
+	fileName, err := s.enc.WriteToRecFile(key, roundNum, teamSide)
+	if err != nil {
+		return "", err
+	}
+	if manifest != nil {
+		manifest.Team = teamSide
+		manifest.File, _ = filepath.Rel(s.enc.SaveDir(), fileName)
+		manifest.File = filepath.ToSlash(manifest.File)
+		manifest.Frames = frames
+	}
+	// 输出更简洁的日志
+	ilog.InfoLogger.Printf("    ✓ %s (%s) - %d 帧", recording.Header.Name, teamName, frames)
+	return fileName, nil
+}
+
+// markDeath 记录玩家在当前回合的死亡 tick
+func (s *demoState) markDeath(player *common.Player, tick int) {
+	if player == nil {
+		return
+	}
+	if manifest := s.players[playerKey(player)]; manifest != nil && manifest.DeathTick == nil {
+		manifest.DeathTick = &tick
 	}
 }
@@ -1,6 +1,10 @@
 package parser
 
-import ilog "github.com/dxldb/minidemo-encoder/internal/logger"
+import (
+	"sort"
+
+	ilog "github.com/dxldb/minidemo-encoder/internal/logger"
+)
 
 type CSWeaponID int32
 
@@ -107,6 +111,7 @@ const (
 )
 
 var WeaponMap map[string]CSWeaponID
+var weaponNameMap map[CSWeaponID]string
 
 func init() {
 	WeaponMap = map[string]CSWeaponID{
@@ -181,6 +186,19 @@ func init() {
 		"Zeus x27":           CSWeapon_TASER,
 		"C4":                 CSWeapon_C4,
 	}
+
+	// 同一ID可能对应多个名称，取字典序最小的保证结果稳定
+	names := make([]string, 0, len(WeaponMap))
+	for name := range WeaponMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	weaponNameMap = make(map[CSWeaponID]string, len(WeaponMap))
+	for _, name := range names {
+		if _, ok := weaponNameMap[WeaponMap[name]]; !ok {
+			weaponNameMap[WeaponMap[name]] = name
+		}
+	}
 }
 
 func WeaponStr2ID(weaponName string) CSWeaponID {
@@ -191,3 +209,128 @@ func WeaponStr2ID(weaponName string) CSWeaponID {
 		return CSWeapon_NONE
 	}
 }
+
+// IsValidWeaponID 判断 id 是否为 CSWeaponID 中定义的武器
+func IsValidWeaponID(id CSWeaponID) bool {
+	if id >= CSWeapon_NONE && id <= CSWeapon_HEAVYASSAULTSUIT {
+		return true
+	}
+	switch id {
+	case CSWeapon_CUTTERS, CSWeapon_HEALTHSHOT, CSWeapon_KNIFE_T, CSWeapon_M4A1_SILENCER,
+		CSWeapon_USP_SILENCER, CSWeapon_CZ75A, CSWeapon_REVOLVER, CSWeapon_TAGGRENADE,
+		CSWeapon_FISTS, CSWeapon_BREACHCHARGE, CSWeapon_TABLET, CSWeapon_MELEE, CSWeapon_AXE,
+		CSWeapon_HAMMER, CSWeapon_SPANNER, CSWeapon_KNIFE_GHOST, CSWeapon_FIREBOMB,
+		CSWeapon_DIVERSION, CSWeapon_FRAGGRENADE, CSWeapon_SNOWBALL, CSWeapon_BUMPMINE,
+		CSWeapon_BAYONET, CSWeapon_KNIFE_CLASSIC, CSWeapon_KNIFE_FLIP, CSWeapon_KNIFE_GUT,
+		CSWeapon_KNIFE_KARAMBIT, CSWeapon_KNIFE_M9_BAYONET, CSWeapon_KNIFE_TATICAL,
+		CSWeapon_KNIFE_FALCHION, CSWeapon_KNIFE_SURVIVAL_BOWIE, CSWeapon_KNIFE_BUTTERFLY,
+		CSWeapon_KNIFE_PUSH, CSWeapon_KNIFE_CORD, CSWeapon_KNIFE_CANIS, CSWeapon_KNIFE_URSUS,
+		CSWeapon_KNIFE_GYPSY_JACKKNIFE, CSWeapon_KNIFE_OUTDOOR, CSWeapon_KNIFE_STILETTO,
+		CSWeapon_KNIFE_WIDOWMAKER, CSWeapon_KNIFE_SKELETON:
+		return true
+	}
+	return false
+}
+
+func WeaponID2Str(weaponID CSWeaponID) string {
+	if weaponName, ok := weaponNameMap[weaponID]; ok {
+		return weaponName
+	}
+	return ""
+}
+
+// 各武器手持时的最大移动速度
+var weaponMaxSpeed = map[CSWeaponID]float32{
+	// Pistols
+	CSWeapon_DEAGLE:       230,
+	CSWeapon_REVOLVER:     220,
+	CSWeapon_GLOCK:        240,
+	CSWeapon_USP_SILENCER: 240,
+	CSWeapon_FIVESEVEN:    240,
+	CSWeapon_TEC9:         240,
+	CSWeapon_P250:         240,
+	CSWeapon_CZ75A:        240,
+	CSWeapon_ELITE:        240,
+	CSWeapon_HKP2000:      240,
+	// Shotguns
+	CSWeapon_XM1014:   215,
+	CSWeapon_NOVA:     220,
+	CSWeapon_MAG7:     225,
+	CSWeapon_SAWEDOFF: 210,
+	// Submachine guns
+	CSWeapon_MAC10:   240,
+	CSWeapon_MP5NAVY: 235,
+	CSWeapon_MP7:     220,
+	CSWeapon_MP9:     240,
+	CSWeapon_P90:     230,
+	CSWeapon_BIZON:   240,
+	CSWeapon_UMP45:   230,
+	// Rifles
+	CSWeapon_AK47:          215,
+	CSWeapon_AUG:           220,
+	CSWeapon_AWP:           200,
+	CSWeapon_FAMAS:         220,
+	CSWeapon_G3SG1:         215,
+	CSWeapon_GALILAR:       215,
+	CSWeapon_M4A1_SILENCER: 225,
+	CSWeapon_M4A1:          225,
+	CSWeapon_SCAR20:        215,
+	CSWeapon_SG556:         210,
+	CSWeapon_SSG08:         230,
+	// Machine guns
+	CSWeapon_M249:  195,
+	CSWeapon_NEGEV: 150,
+	// Grenades
+	CSWeapon_DECOY:        245,
+	CSWeapon_FLASHBANG:    245,
+	CSWeapon_HEGRENADE:    245,
+	CSWeapon_INCGRENADE:   245,
+	CSWeapon_MOLOTOV:      245,
+	CSWeapon_SMOKEGRENADE: 245,
+	CSWeapon_TASER:        220,
+}
+
+// WeaponMaxSpeed 返回手持该武器时的最大移动速度，刀、C4 等为 250
+func WeaponMaxSpeed(weaponID CSWeaponID) float32 {
+	if speed, ok := weaponMaxSpeed[weaponID]; ok {
+		return speed
+	}
+	return 250
+}
+
+// 按住开火键可以连续射击的武器的射击间隔 (秒)，包括 CZ75、XM1014 与 G3SG1/SCAR20；
+// 不在表中的武器每次开火都需要重新按下开火键
+var weaponCycleTime = map[CSWeaponID]float64{
+	// Pistols
+	CSWeapon_CZ75A: 0.1,
+	// Shotguns
+	CSWeapon_XM1014: 0.35,
+	// Submachine guns
+	CSWeapon_MAC10:   0.075,
+	CSWeapon_MP5NAVY: 0.08,
+	CSWeapon_MP7:     0.08,
+	CSWeapon_MP9:     0.07,
+	CSWeapon_P90:     0.07,
+	CSWeapon_BIZON:   0.08,
+	CSWeapon_UMP45:   0.09,
+	// Rifles
+	CSWeapon_AK47:          0.1,
+	CSWeapon_AUG:           0.09,
+	CSWeapon_FAMAS:         0.09,
+	CSWeapon_G3SG1:         0.25,
+	CSWeapon_GALILAR:       0.09,
+	CSWeapon_M4A1_SILENCER: 0.1,
+	CSWeapon_M4A1:          0.09,
+	CSWeapon_SCAR20:        0.25,
+	CSWeapon_SG556:         0.09,
+	// Machine guns
+	CSWeapon_M249:  0.08,
+	CSWeapon_NEGEV: 0.075,
+}
+
+// WeaponCycleTime 返回可以按住连续射击的武器的射击间隔，表中以外的半自动武器
+// (其他手枪、栓动狙击枪与泵动霰弹枪) 返回 false
+func WeaponCycleTime(weaponID CSWeaponID) (float64, bool) {
+	cycle, ok := weaponCycleTime[weaponID]
+	return cycle, ok
+}
@@ -0,0 +1,64 @@
+package sim
+
+import (
+	"math"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+// AdaptiveKeyframes 根据模拟的回放偏移决定关键帧：
+// 偏移超过 Threshold、落地、上下梯子或出现传送式位移 (超过 rec.MAX_VELOCITY) 时同步位置与速度。
+type AdaptiveKeyframes struct {
+	// 触发关键帧的偏移距离
+	Threshold float64
+
+	cfg         Config
+	sim         *Simulator
+	wasAirborne bool
+	wasOnLadder bool
+}
+
+// NewAdaptiveKeyframes 创建自适应关键帧策略，cfg.TickRate 为 0 时使用 demo 的 tickrate
+func NewAdaptiveKeyframes(cfg Config, threshold float64) *AdaptiveKeyframes {
+	return &AdaptiveKeyframes{Threshold: threshold, cfg: cfg}
+}
+
+func distance(a, b [3]float32) float64 {
+	dx := float64(a[0] - b[0])
+	dy := float64(a[1] - b[1])
+	dz := float64(a[2] - b[2])
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+func (a *AdaptiveKeyframes) IsKeyframe(frames []rec.FrameInfo, frame *rec.FrameInfo, ctx iparser.FrameContext) bool {
+	keyframe := ctx.FullSnap || ctx.FrameIndex == 0 || a.sim == nil
+	if !keyframe {
+		prev := &frames[len(frames)-1]
+		// 回放时 bot 用上一帧的输入移动到这一帧
+		a.sim.Step(prev)
+		a.sim.Sync(frame)
+
+		drifted := distance(a.sim.Origin(), frame.Origin) > a.Threshold
+		landed := a.wasAirborne && !ctx.Airborne
+		ladder := a.wasOnLadder != ctx.OnLadder
+		teleported := distance(prev.Origin, frame.Origin) > rec.MAX_VELOCITY/ctx.TickRate
+		keyframe = drifted || landed || ladder || teleported
+	}
+	a.wasAirborne = ctx.Airborne
+	a.wasOnLadder = ctx.OnLadder
+
+	if keyframe {
+		if a.sim == nil {
+			cfg := a.cfg
+			if cfg.TickRate == 0 {
+				cfg.TickRate = ctx.TickRate
+			}
+			a.sim = NewSimulator(cfg, frame.Origin, frame.ActualVelocity)
+			a.sim.Sync(frame)
+		} else {
+			a.sim.Teleport(frame.Origin, frame.ActualVelocity)
+		}
+	}
+	return keyframe
+}
@@ -0,0 +1,254 @@
+// Package sim 离线模拟 source 引擎的玩家移动，用于评估录像回放时的位置偏移。
+//
+// 模拟器按 BotMimic 回放的方式读取每一帧的按键、PredictedVelocity 与视角，
+// 使用 friction / accelerate / airaccelerate / gravity 计算下一帧的位置，
+// 并与录像中记录的 Origin 比较。关键帧 (FIELDS_ORIGIN / FIELDS_VELOCITY) 会像回放时一样同步位置和速度。
+//
+// 由于没有地图数据，是否在地面以及地面高度取自录像本身。
+package sim
+
+import (
+	"math"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+// Config 模拟使用的服务器参数
+type Config struct {
+	TickRate      float64
+	Friction      float64 // sv_friction
+	StopSpeed     float64 // sv_stopspeed
+	Accelerate    float64 // sv_accelerate
+	AirAccelerate float64 // sv_airaccelerate
+	Gravity       float64 // sv_gravity
+	JumpImpulse   float64 // sv_jump_impulse
+	// 空中加速时的速度上限
+	AirWishSpeed float64
+	// 蹲下与静步时最大速度的倍率
+	DuckSpeedScale float64
+	WalkSpeedScale float64
+	// 手持武器的最大速度
+	MaxSpeed func(weaponID int32) float64
+}
+
+// DefaultConfig 返回竞技模式的默认参数
+func DefaultConfig(tickrate float64) Config {
+	return Config{
+		TickRate:       tickrate,
+		Friction:       5.2,
+		StopSpeed:      80,
+		Accelerate:     5.5,
+		AirAccelerate:  12,
+		Gravity:        800,
+		JumpImpulse:    301.993377,
+		AirWishSpeed:   30,
+		DuckSpeedScale: 0.34,
+		WalkSpeedScale: 0.52,
+		MaxSpeed: func(weaponID int32) float64 {
+			return float64(iparser.WeaponMaxSpeed(iparser.CSWeaponID(weaponID)))
+		},
+	}
+}
+
+// TickError 单帧的模拟位置与录像位置
+type TickError struct {
+	Tick      int        `json:"tick"`
+	Simulated [3]float32 `json:"simulated"`
+	Recorded  [3]float32 `json:"recorded"`
+	// 三维距离与水平距离
+	Error           float64 `json:"error"`
+	HorizontalError float64 `json:"horizontal_error"`
+	Keyframe        bool    `json:"keyframe"`
+}
+
+// Report 整段录像的偏移统计
+type Report struct {
+	Ticks        []TickError `json:"ticks"`
+	MaxError     float64     `json:"max_error"`
+	MaxErrorTick int         `json:"max_error_tick"`
+	MeanError    float64     `json:"mean_error"`
+	RMSError     float64     `json:"rms_error"`
+	FinalError   float64     `json:"final_error"`
+}
+
+type vector [3]float64
+
+func toVector(v [3]float32) vector {
+	return vector{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
+func (v vector) float32s() [3]float32 {
+	return [3]float32{float32(v[0]), float32(v[1]), float32(v[2])}
+}
+
+// 垂直速度低于该值时认为录像中的玩家站在地面上
+const groundSpeedEpsilon = 1.0
+
+// OnGround 判断录像中该帧的玩家是否站在地面上
+func OnGround(frame *rec.FrameInfo) bool {
+	return math.Abs(float64(frame.ActualVelocity[2])) < groundSpeedEpsilon
+}
+
+// Simulator 逐帧模拟单个玩家的移动
+type Simulator struct {
+	cfg       Config
+	frametime float64
+	origin    vector
+	velocity  vector
+	weaponID  int32
+}
+
+func NewSimulator(cfg Config, origin, velocity [3]float32) *Simulator {
+	return &Simulator{
+		cfg:       cfg,
+		frametime: 1.0 / cfg.TickRate,
+		origin:    toVector(origin),
+		velocity:  toVector(velocity),
+	}
+}
+
+// Origin 返回当前模拟的位置
+func (s *Simulator) Origin() [3]float32 {
+	return s.origin.float32s()
+}
+
+// Teleport 同步位置与速度，与回放时的关键帧效果相同
+func (s *Simulator) Teleport(origin, velocity [3]float32) {
+	s.origin = toVector(origin)
+	s.velocity = toVector(velocity)
+}
+
+// Sync 在帧开始时应用录像中的状态：切换武器、关键帧传送以及地面高度
+func (s *Simulator) Sync(frame *rec.FrameInfo) {
+	if frame.CSWeaponID != int32(iparser.CSWeapon_NONE) {
+		s.weaponID = frame.CSWeaponID
+	}
+	// 回放时关键帧会直接传送 bot
+	if frame.AdditionalFields&rec.FIELDS_ORIGIN != 0 {
+		s.origin = toVector(frame.AtOrigin)
+	}
+	if frame.AdditionalFields&rec.FIELDS_VELOCITY != 0 {
+		s.velocity = toVector(frame.AtVelocity)
+	}
+	if OnGround(frame) {
+		// 没有地图数据，地面高度取自录像
+		s.origin[2] = float64(frame.Origin[2])
+	}
+}
+
+// Step 使用 frame 的输入计算下一帧的位置
+func (s *Simulator) Step(frame *rec.FrameInfo) {
+	s.move(frame, OnGround(frame))
+}
+
+func (s *Simulator) maxSpeed(buttons int32) float64 {
+	speed := s.cfg.MaxSpeed(s.weaponID)
+	if buttons&iparser.IN_DUCK != 0 {
+		speed *= s.cfg.DuckSpeedScale
+	} else if buttons&iparser.IN_SPEED != 0 {
+		speed *= s.cfg.WalkSpeedScale
+	}
+	return speed
+}
+
+func (s *Simulator) friction() {
+	speed := math.Hypot(s.velocity[0], s.velocity[1])
+	if speed < 0.1 {
+		return
+	}
+	control := math.Max(speed, s.cfg.StopSpeed)
+	drop := control * s.cfg.Friction * s.frametime
+	newSpeed := math.Max(speed-drop, 0) / speed
+	s.velocity[0] *= newSpeed
+	s.velocity[1] *= newSpeed
+}
+
+// accelerate 对应 CGameMovement::Accelerate / AirAccelerate
+func (s *Simulator) accelerate(wishDir vector, wishSpeed, accel, speedCap float64) {
+	currentSpeed := s.velocity[0]*wishDir[0] + s.velocity[1]*wishDir[1]
+	addSpeed := math.Min(wishSpeed, speedCap) - currentSpeed
+	if addSpeed <= 0 {
+		return
+	}
+	accelSpeed := math.Min(accel*wishSpeed*s.frametime, addSpeed)
+	s.velocity[0] += accelSpeed * wishDir[0]
+	s.velocity[1] += accelSpeed * wishDir[1]
+}
+
+// move 使用 frame 的输入计算下一帧的位置，grounded 表示本帧是否在地面
+func (s *Simulator) move(frame *rec.FrameInfo, grounded bool) {
+	yaw := float64(frame.PredictedAngles[1]) * math.Pi / 180
+	forwardX, forwardY := math.Cos(yaw), math.Sin(yaw)
+	rightX, rightY := math.Sin(yaw), -math.Cos(yaw)
+	forwardMove := float64(frame.PredictedVelocity[0])
+	sideMove := float64(frame.PredictedVelocity[1])
+
+	wishDir := vector{forwardX*forwardMove + rightX*sideMove, forwardY*forwardMove + rightY*sideMove, 0}
+	wishSpeed := math.Hypot(wishDir[0], wishDir[1])
+	if wishSpeed > 0 {
+		wishDir[0] /= wishSpeed
+		wishDir[1] /= wishSpeed
+	}
+	wishSpeed = math.Min(wishSpeed, s.maxSpeed(frame.PlayerButtons))
+
+	if grounded && frame.PlayerButtons&iparser.IN_JUMP != 0 {
+		s.velocity[2] = s.cfg.JumpImpulse
+		grounded = false
+	}
+	if grounded {
+		s.velocity[2] = 0
+		s.friction()
+		s.accelerate(wishDir, wishSpeed, s.cfg.Accelerate, wishSpeed)
+	} else {
+		s.accelerate(wishDir, wishSpeed, s.cfg.AirAccelerate, s.cfg.AirWishSpeed)
+		s.velocity[2] -= s.cfg.Gravity * s.frametime
+	}
+	for idx := 0; idx < 3; idx++ {
+		s.origin[idx] += s.velocity[idx] * s.frametime
+	}
+}
+
+// Simulate 模拟整段录像并返回每一帧的位置偏移。
+// 偏移以帧的 Origin 为准，v1 录像没有该字段，调用前需要排除。
+func Simulate(recording *rec.Recording, cfg Config) *Report {
+	var velocity [3]float32
+	if len(recording.Frames) > 0 {
+		velocity = recording.Frames[0].ActualVelocity
+	}
+	s := NewSimulator(cfg, recording.Header.Position, velocity)
+	report := &Report{Ticks: make([]TickError, 0, len(recording.Frames))}
+
+	var sum, sumSquare float64
+	for tick := range recording.Frames {
+		frame := &recording.Frames[tick]
+		s.Sync(frame)
+
+		recorded := toVector(frame.Origin)
+		dx, dy, dz := s.origin[0]-recorded[0], s.origin[1]-recorded[1], s.origin[2]-recorded[2]
+		tickErr := TickError{
+			Tick:            tick,
+			Simulated:       s.origin.float32s(),
+			Recorded:        frame.Origin,
+			Error:           math.Sqrt(dx*dx + dy*dy + dz*dz),
+			HorizontalError: math.Hypot(dx, dy),
+			Keyframe:        frame.AdditionalFields&(rec.FIELDS_ORIGIN|rec.FIELDS_VELOCITY) != 0,
+		}
+		report.Ticks = append(report.Ticks, tickErr)
+		sum += tickErr.Error
+		sumSquare += tickErr.Error * tickErr.Error
+		if tickErr.Error > report.MaxError {
+			report.MaxError = tickErr.Error
+			report.MaxErrorTick = tick
+		}
+
+		s.Step(frame)
+	}
+
+	if count := float64(len(report.Ticks)); count > 0 {
+		report.MeanError = sum / count
+		report.RMSError = math.Sqrt(sumSquare / count)
+		report.FinalError = report.Ticks[len(report.Ticks)-1].Error
+	}
+	return report
+}
@@ -0,0 +1,109 @@
+package sim
+
+import (
+	"testing"
+
+	iparser "github.com/dxldb/minidemo-encoder/internal/parser"
+	"github.com/dxldb/minidemo-encoder/pkg/rec"
+)
+
+const testTickRate = 64.0
+
+// walkRecording 以最大速度 250 沿 +X 直线行走的录像，input 为 false 时录像中没有前进输入
+func walkRecording(count int, input bool) *rec.Recording {
+	r := rec.NewRecording(rec.FrameInitInfo{PlayerName: "walker"})
+	for idx := 0; idx < count; idx++ {
+		var frame rec.FrameInfo
+		frame.Origin = [3]float32{float32(250 * float64(idx) / testTickRate), 0, 0}
+		frame.ActualVelocity = [3]float32{250, 0, 0}
+		if input {
+			frame.PredictedVelocity[0] = 450
+			frame.PlayerButtons = iparser.IN_FORWARD
+		}
+		r.AddFrame(frame)
+	}
+	return r
+}
+
+func TestSimulateStraightWalk(t *testing.T) {
+	report := Simulate(walkRecording(128, true), DefaultConfig(testTickRate))
+	if len(report.Ticks) != 128 {
+		t.Fatalf("统计了 %d 帧，期望 128 帧", len(report.Ticks))
+	}
+	// 最大速度下摩擦力与加速度抵消，模拟的位置与录像一致
+	if report.MaxError > 0.01 {
+		t.Errorf("最大偏移 %.4f (第 %d 帧)，期望接近 0", report.MaxError, report.MaxErrorTick)
+	}
+}
+
+func TestSimulateDrift(t *testing.T) {
+	// 录像中缺少前进输入时回放的 bot 会停下，偏移逐帧增大
+	report := Simulate(walkRecording(128, false), DefaultConfig(testTickRate))
+	for idx := 1; idx < len(report.Ticks); idx++ {
+		if report.Ticks[idx].Error < report.Ticks[idx-1].Error {
+			t.Fatalf("第 %d 帧的偏移 %.2f 小于上一帧 %.2f", idx, report.Ticks[idx].Error, report.Ticks[idx-1].Error)
+		}
+	}
+	if report.FinalError < 100 {
+		t.Errorf("最终偏移 %.2f，期望大于 100", report.FinalError)
+	}
+	if report.MaxErrorTick != len(report.Ticks)-1 {
+		t.Errorf("最大偏移位于第 %d 帧，期望最后一帧", report.MaxErrorTick)
+	}
+
+	// 关键帧同步位置与速度，之后的偏移重新从 0 开始
+	r := walkRecording(128, false)
+	keyframe := &r.Frames[64]
+	keyframe.AdditionalFields = rec.FIELDS_ORIGIN | rec.FIELDS_VELOCITY
+	keyframe.AtOrigin = keyframe.Origin
+	keyframe.AtVelocity = keyframe.ActualVelocity
+	report = Simulate(r, DefaultConfig(testTickRate))
+	if !report.Ticks[64].Keyframe || report.Ticks[64].Error > 0.01 {
+		t.Errorf("关键帧的偏移 %.2f，期望为 0", report.Ticks[64].Error)
+	}
+	if report.FinalError >= report.Ticks[63].Error {
+		t.Errorf("关键帧之后的最终偏移 %.2f 没有小于关键帧之前的 %.2f", report.FinalError, report.Ticks[63].Error)
+	}
+}
+
+func TestAdaptiveKeyframes(t *testing.T) {
+	const threshold = 8.0
+	frames := walkRecording(96, false).Frames
+	strategy := NewAdaptiveKeyframes(DefaultConfig(0), threshold)
+	sim := NewSimulator(DefaultConfig(testTickRate), frames[0].Origin, frames[0].ActualVelocity)
+
+	var keyframes []int
+	for idx := range frames {
+		ctx := iparser.FrameContext{TickRate: testTickRate, FrameIndex: idx}
+		keyframe := strategy.IsKeyframe(frames[:idx], &frames[idx], ctx)
+		if idx > 0 {
+			// 与策略相同的方式独立模拟，检查关键帧恰好在偏移超过阈值时插入
+			sim.Step(&frames[idx-1])
+			sim.Sync(&frames[idx])
+			drift := distance(sim.Origin(), frames[idx].Origin)
+			if keyframe != (drift > threshold) {
+				t.Fatalf("第 %d 帧偏移 %.2f，关键帧 %v", idx, drift, keyframe)
+			}
+		}
+		if keyframe {
+			keyframes = append(keyframes, idx)
+			sim.Teleport(frames[idx].Origin, frames[idx].ActualVelocity)
+		}
+	}
+	if len(keyframes) < 2 || keyframes[0] != 0 {
+		t.Fatalf("关键帧 %v，期望第 0 帧以及偏移超过阈值的帧", keyframes)
+	}
+	if keyframes[1] < 2 {
+		t.Errorf("第一次偏移超过阈值的帧为 %d，偏移不应立即超过阈值", keyframes[1])
+	}
+
+	// 录像中的输入正确时不需要额外的关键帧
+	frames = walkRecording(96, true).Frames
+	strategy = NewAdaptiveKeyframes(DefaultConfig(0), threshold)
+	for idx := range frames {
+		ctx := iparser.FrameContext{TickRate: testTickRate, FrameIndex: idx}
+		if strategy.IsKeyframe(frames[:idx], &frames[idx], ctx) && idx != 0 {
+			t.Errorf("第 %d 帧不应为关键帧", idx)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package rec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 按文件声明的帧数预分配时的上限，避免损坏的文件造成巨量内存分配
+const maxPreallocFrames = 1 << 16
+
+type decoder struct {
+	r      io.Reader
+	format Format
+}
+
+func (d *decoder) read(section string, data interface{}) error {
+	if err := binary.Read(d.r, binary.LittleEndian, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &TruncatedError{Section: section, Err: err}
+	}
+	return nil
+}
+
+// Decode 读取 WriteTo 写出的 .rec 数据，支持所有已注册的格式版本
+func Decode(r io.Reader) (*Recording, error) {
+	d := &decoder{r: r}
+	recording := new(Recording)
+	if err := d.readHeader(&recording.Header); err != nil {
+		return nil, err
+	}
+
+	// step.8 tick count
+	var tickCount int32
+	if err := d.read("tick count", &tickCount); err != nil {
+		return nil, err
+	}
+	if tickCount < 0 {
+		return nil, fmt.Errorf("rec: 非法的帧数 %d", tickCount)
+	}
+
+	// step.9 bookmark count
+	var bookmarkCount int32
+	if err := d.read("bookmark count", &bookmarkCount); err != nil {
+		return nil, err
+	}
+	if bookmarkCount < 0 {
+		return nil, fmt.Errorf("rec: 非法的书签数 %d", bookmarkCount)
+	}
+
+	// step.10 all bookmark
+	for idx := int32(0); idx < bookmarkCount; idx++ {
+		bookmark, err := d.readBookmark(idx)
+		if err != nil {
+			return nil, err
+		}
+		recording.Bookmarks = append(recording.Bookmarks, bookmark)
+	}
+
+	// step.11 all tick frame
+	prealloc := tickCount
+	if prealloc > maxPreallocFrames {
+		prealloc = maxPreallocFrames
+	}
+	recording.Frames = make([]FrameInfo, 0, prealloc)
+	for idx := int32(0); idx < tickCount; idx++ {
+		frame, err := d.readFrame(idx)
+		if err != nil {
+			return nil, err
+		}
+		recording.Frames = append(recording.Frames, frame)
+	}
+	return recording, nil
+}
+
+func (d *decoder) readHeader(header *Header) error {
+	// step.1 MAGIC NUMBER
+	if err := d.read("magic", &header.Magic); err != nil {
+		return err
+	}
+	if header.Magic != __MAGIC__ {
+		return &MagicError{Magic: header.Magic}
+	}
+
+	// step.2 VERSION
+	if err := d.read("version", &header.Version); err != nil {
+		return err
+	}
+	format, ok := LookupFormat(header.Version)
+	if !ok {
+		return &VersionError{Version: header.Version}
+	}
+	d.format = format
+
+	// step.3 timestamp
+	if err := d.read("timestamp", &header.Timestamp); err != nil {
+		return err
+	}
+
+	// step.4 name length
+	var nameLength uint8
+	if err := d.read("name length", &nameLength); err != nil {
+		return err
+	}
+
+	// step.5 name
+	name := make([]byte, nameLength)
+	if err := d.read("name", name); err != nil {
+		return err
+	}
+	header.Name = string(name)
+
+	// step.6 initial position
+	if err := d.read("initial position", &header.Position); err != nil {
+		return err
+	}
+
+	// step.7 initial angle
+	return d.read("initial angles", &header.Angles)
+}
+
+func (d *decoder) readBookmark(idx int32) (Bookmark, error) {
+	section := fmt.Sprintf("bookmark %d", idx)
+	var bookmark Bookmark
+	if err := d.read(section, &bookmark.Frame); err != nil {
+		return bookmark, err
+	}
+	if err := d.read(section, &bookmark.AdditionalTeleportTick); err != nil {
+		return bookmark, err
+	}
+	var name [BOOKMARK_NAME_LENGTH]byte
+	if err := d.read(section, &name); err != nil {
+		return bookmark, err
+	}
+	if end := bytes.IndexByte(name[:], 0); end >= 0 {
+		bookmark.Name = string(name[:end])
+	} else {
+		bookmark.Name = string(name[:])
+	}
+	return bookmark, nil
+}
+
+func (d *decoder) readFrame(idx int32) (FrameInfo, error) {
+	var frame FrameInfo
+	if err := d.format.ReadFrame(d.r, &frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frame, &TruncatedError{Section: fmt.Sprintf("frame %d", idx), Err: err}
+	}
+	return frame, nil
+}
@@ -0,0 +1,324 @@
+package rec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const __MAGIC__ int32 = -559038737
+const __FORMAT_VERSION__ int8 = 2 // 默认写出的格式版本
+const FIELDS_ORIGIN int32 = 1 << 0
+const FIELDS_ANGLES int32 = 1 << 1
+const FIELDS_VELOCITY int32 = 1 << 2
+
+// 书签名长度，对应 BotMimic 的 MAX_BOOKMARK_NAME_LENGTH
+const BOOKMARK_NAME_LENGTH = 64
+
+// NewRecording 根据初始帧创建录像
+func NewRecording(initFrame FrameInitInfo) *Recording {
+	return &Recording{
+		Header: Header{
+			Magic:     __MAGIC__,
+			Version:   __FORMAT_VERSION__,
+			Timestamp: int32(time.Now().Unix()),
+			Name:      truncateName(initFrame.PlayerName),
+			Position:  initFrame.Position,
+			Angles:    initFrame.Angles,
+		},
+	}
+}
+
+// AddFrame 追加一帧，流式写出时内存中的帧超过窗口大小后写入临时文件
+func (r *Recording) AddFrame(frame FrameInfo) {
+	r.Frames = append(r.Frames, frame)
+	if r.spool != nil && len(r.Frames) >= 2*streamWindow {
+		r.flush(streamWindow)
+	}
+}
+
+// AddBookmark 在第 frame 帧 (从录像开始计数) 添加书签。
+// AdditionalTeleportTick 为该帧之前的关键帧数量，BotMimic 跳转到书签时从这里继续读取关键帧。
+func (r *Recording) AddBookmark(frame int32, name string) {
+	r.Bookmarks = append(r.Bookmarks, Bookmark{
+		Frame:                  frame,
+		AdditionalTeleportTick: r.teleportsBefore(frame),
+		Name:                   name,
+	})
+}
+
+// teleportsBefore 返回第 frame 帧之前的关键帧数量
+func (r *Recording) teleportsBefore(frame int32) int32 {
+	var teleports int32
+	offset := 0
+	if r.spool != nil {
+		teleports = int32(sort.SearchInts(r.spool.keyframes, int(frame)))
+		offset = r.spool.frames
+	}
+	for idx := 0; idx < len(r.Frames) && offset+idx < int(frame); idx++ {
+		if r.Frames[idx].AdditionalFields != 0 {
+			teleports++
+		}
+	}
+	return teleports
+}
+
+// clampBookmarks 将最后一帧之后的书签移到最后一帧。
+// 回合结束时同一 tick 的事件 (拆包、最后一次击杀) 在该帧录制之前分发，书签会指向没有录制的帧。
+func (r *Recording) clampBookmarks() {
+	last := int32(r.FrameCount() - 1)
+	if last < 0 {
+		return
+	}
+	for idx := range r.Bookmarks {
+		if r.Bookmarks[idx].Frame > last {
+			r.Bookmarks[idx].Frame = last
+			r.Bookmarks[idx].AdditionalTeleportTick = r.teleportsBefore(last)
+		}
+	}
+}
+
+// WriteTo 将录像按 Header.Version 对应的 BotMimic 格式编码后写入 w
+func (r *Recording) WriteTo(w io.Writer) (int64, error) {
+	format, ok := LookupFormat(r.Header.Version)
+	if !ok {
+		return 0, &VersionError{Version: r.Header.Version}
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.buf.Reset()
+	r.encodeHeader()
+	r.encodeBookmarks()
+	n, err := w.Write(r.buf.Bytes())
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	if r.spool != nil {
+		copied, err := r.copySpool(w)
+		written += copied
+		if err != nil {
+			return written, err
+		}
+	}
+	r.buf.Reset()
+	r.encodeFrames(format)
+	n, err = w.Write(r.buf.Bytes())
+	return written + int64(n), err
+}
+
+func (r *Recording) encodeHeader() {
+	// step.1 MAGIC NUMBER
+	writeToBuf(&r.buf, __MAGIC__)
+
+	// step.2 VERSION
+	writeToBuf(&r.buf, r.Header.Version)
+
+	// step.3 timestamp
+	writeToBuf(&r.buf, r.Header.Timestamp)
+
+	// step.4 name length
+	// 超过 BotMimic 长度限制的录像名会被截断，也避免长度溢出 int8
+	name := truncateName(r.Header.Name)
+	writeToBuf(&r.buf, int8(len(name)))
+
+	// step.5 name
+	writeToBuf(&r.buf, []byte(name))
+
+	// step.6 initial position
+	for idx := 0; idx < 3; idx++ {
+		writeToBuf(&r.buf, r.Header.Position[idx])
+	}
+
+	// step.7 initial angle
+	for idx := 0; idx < 2; idx++ {
+		writeToBuf(&r.buf, r.Header.Angles[idx])
+	}
+}
+
+func (r *Recording) encodeBookmarks() {
+	// step.8 tick count
+	writeToBuf(&r.buf, int32(r.FrameCount()))
+
+	// step.9 bookmark count
+	writeToBuf(&r.buf, int32(len(r.Bookmarks)))
+
+	// step.10 all bookmark
+	for _, bookmark := range r.Bookmarks {
+		writeToBuf(&r.buf, bookmark.Frame)
+		writeToBuf(&r.buf, bookmark.AdditionalTeleportTick)
+		// 名称以 \0 结尾，超长时截断
+		var name [BOOKMARK_NAME_LENGTH]byte
+		copy(name[:BOOKMARK_NAME_LENGTH-1], bookmark.Name)
+		writeToBuf(&r.buf, name)
+	}
+}
+
+func (r *Recording) encodeFrames(format Format) {
+	// step.11 all tick frame
+	for idx := range r.Frames {
+		format.WriteFrame(&r.buf, &r.Frames[idx])
+	}
+}
+
+// Encoder 管理一个 demo 内所有玩家的录像，以 SteamID64 区分玩家。
+// 每个 Encoder 的状态相互独立，可以在同一进程中并发编码多个 demo，
+// 但单个 Encoder 不是并发安全的。
+type Encoder struct {
+	saveDir       string
+	formatVersion int8
+	// 录像文件头中的时间戳来源
+	clock func() time.Time
+	// 流式写出时临时文件所在的目录
+	streaming bool
+	spoolDir  string
+	// 第一次创建临时文件失败的错误，之后的录像不再流式写出
+	streamErr  error
+	recordings map[uint64]*Recording
+	// 已写出的文件路径 (小写) -> SteamID64，用于处理同名玩家
+	files map[string]uint64
+}
+
+func NewEncoder(saveDir string) *Encoder {
+	return &Encoder{
+		saveDir:       saveDir,
+		formatVersion: __FORMAT_VERSION__,
+		clock:         time.Now,
+		recordings:    make(map[uint64]*Recording),
+		files:         make(map[string]uint64),
+	}
+}
+
+// SetFormatVersion 设置之后初始化的录像使用的格式版本，version 为 0 时使用默认版本
+func (e *Encoder) SetFormatVersion(version int8) error {
+	if version == 0 {
+		version = __FORMAT_VERSION__
+	}
+	if _, ok := LookupFormat(version); !ok {
+		return &VersionError{Version: version}
+	}
+	e.formatVersion = version
+	return nil
+}
+
+func (e *Encoder) SaveDir() string {
+	return e.saveDir
+}
+
+// SetClock 设置录像文件头时间戳的来源，默认为 time.Now
+func (e *Encoder) SetClock(clock func() time.Time) {
+	e.clock = clock
+}
+
+// SetStreaming 设置之后初始化的录像是否流式写出 (见 Recording.Stream)，
+// spoolDir 为临时文件所在的目录，为空时使用系统临时目录
+func (e *Encoder) SetStreaming(enabled bool, spoolDir string) {
+	e.streaming = enabled
+	e.spoolDir = spoolDir
+}
+
+// InitPlayer 为玩家开始一段新的录像，丢弃之前未保存的帧
+func (e *Encoder) InitPlayer(steamID uint64, initFrame FrameInitInfo) *Recording {
+	r := NewRecording(initFrame)
+	r.Header.Version = e.formatVersion
+	r.Header.Timestamp = int32(e.clock().Unix())
+	if e.streaming {
+		// 无法创建临时文件时退回到内存中保存全部帧，错误由 StreamError 返回
+		if err := r.Stream(e.spoolDir); err != nil {
+			e.streaming = false
+			e.streamErr = err
+		}
+	}
+	e.SetRecording(steamID, r)
+	return r
+}
+
+// StreamError 返回创建临时文件失败的错误，出错后录像全部保存在内存中
+func (e *Encoder) StreamError() error {
+	return e.streamErr
+}
+
+// Recording 返回玩家当前的录像，未初始化时返回 nil
+func (e *Encoder) Recording(steamID uint64) *Recording {
+	return e.recordings[steamID]
+}
+
+// SetRecording 替换玩家当前的录像，r 为 nil 时丢弃
+func (e *Encoder) SetRecording(steamID uint64, r *Recording) {
+	if old := e.recordings[steamID]; old != nil && old != r {
+		old.Close()
+	}
+	if r == nil {
+		delete(e.recordings, steamID)
+		return
+	}
+	e.recordings[steamID] = r
+}
+
+// Discard 丢弃所有未保存的录像
+func (e *Encoder) Discard() {
+	for _, r := range e.recordings {
+		r.Close()
+	}
+	e.recordings = make(map[uint64]*Recording)
+}
+
+// Close 丢弃所有未保存的录像并删除临时文件
+func (e *Encoder) Close() error {
+	var firstErr error
+	for _, r := range e.recordings {
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	e.recordings = make(map[uint64]*Recording)
+	return firstErr
+}
+
+// recFilePath 返回玩家录像的文件路径，文件名由玩家名清理得到
+func (e *Encoder) recFilePath(teamDir string, steamID uint64, playerName string) string {
+	return e.UniqueFilePath(teamDir, SanitizeFileName(playerName), steamID)
+}
+
+// UniqueFilePath 返回玩家的文件路径 <dir>/<baseName>.rec，与其他玩家的文件冲突时在 baseName 后追加 SteamID64；
+// Windows 与 macOS 的文件名不区分大小写，只有大小写不同的文件名也视为冲突。
+func (e *Encoder) UniqueFilePath(dir, baseName string, steamID uint64) string {
+	fileName := fmt.Sprintf("%s/%s.rec", dir, baseName)
+	if owner, ok := e.files[strings.ToLower(fileName)]; ok && owner != steamID {
+		fileName = fmt.Sprintf("%s/%s_%d.rec", dir, baseName, steamID)
+	}
+	e.files[strings.ToLower(fileName)] = steamID
+	return fileName
+}
+
+// WriteToRecFile 将玩家录像写入 <saveDir>/round<N>/<teamSide>/ 并返回文件路径
+func (e *Encoder) WriteToRecFile(steamID uint64, roundNum int32, teamSide string) (string, error) {
+	r := e.recordings[steamID]
+	if r == nil {
+		return "", &NoRecordingError{SteamID: steamID}
+	}
+
+	// 新的目录结构：output/demo名称/round1/t/ 或 output/demo名称/round1/ct/
+	roundDir := fmt.Sprintf("%s/round%d", e.saveDir, roundNum)
+	teamDir := fmt.Sprintf("%s/%s", roundDir, teamSide)
+
+	// 确保目录存在
+	if err := os.MkdirAll(teamDir, os.ModePerm); err != nil {
+		return "", &WriteError{Path: teamDir, Err: err}
+	}
+
+	fileName := e.recFilePath(teamDir, steamID, r.Header.Name)
+	r.clampBookmarks()
+	if err := r.WriteFile(fileName); err != nil {
+		return "", err
+	}
+
+	// 清理内存与临时文件
+	r.Close()
+	delete(e.recordings, steamID)
+	return fileName, nil
+}
@@ -0,0 +1,389 @@
+package rec
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// go test ./pkg/rec -update 重新生成 testdata 下的 golden 文件
+var update = flag.Bool("update", false, "重新生成 golden 文件")
+
+// 固定的时间戳，保证编码结果稳定
+var fixedTime = time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+type goldenCase struct {
+	name    string
+	version int8
+	init    FrameInitInfo
+	frames  []FrameInfo
+	// 书签所在的帧与名称
+	bookmarks []Bookmark
+}
+
+// walkFrames 生成一段沿 x 轴移动、每 tick 前进 4 个单位的帧
+func walkFrames(count int) []FrameInfo {
+	frames := make([]FrameInfo, count)
+	for idx := range frames {
+		frame := &frames[idx]
+		frame.PlayerButtons = 1 << 3 // IN_FORWARD
+		frame.ActualVelocity = [3]float32{250, 0, 0}
+		frame.PredictedVelocity = [3]float32{450, 0, 0}
+		frame.PredictedAngles = [2]float32{0, float32(idx % 360)}
+		frame.Origin = [3]float32{float32(idx) * 4, -1024.5, 64}
+	}
+	return frames
+}
+
+func goldenCases() []goldenCase {
+	keyframes := walkFrames(300)
+	keyframes[0].CSWeaponID = 7
+	keyframes[150].CSWeaponID = 28
+	for idx := 0; idx < len(keyframes); idx += 128 {
+		frame := &keyframes[idx]
+		frame.AdditionalFields = FIELDS_ORIGIN | FIELDS_ANGLES | FIELDS_VELOCITY
+		frame.AtOrigin = frame.Origin
+		frame.AtAngles = [3]float32{frame.PredictedAngles[0], frame.PredictedAngles[1], 0}
+		frame.AtVelocity = frame.ActualVelocity
+	}
+	keyframes[200].AdditionalFields = FIELDS_ANGLES
+	keyframes[200].AtAngles = [3]float32{-45, 90, 0}
+
+	return []goldenCase{
+		{
+			name:    "empty",
+			version: 2,
+			init:    FrameInitInfo{PlayerName: "empty"},
+		},
+		{
+			name:    "single_frame",
+			version: 2,
+			init:    FrameInitInfo{PlayerName: "s1mple", Position: [3]float32{1, 2, 3}, Angles: [2]float32{4, 5}},
+			frames:  walkFrames(1),
+		},
+		{
+			name:    "keyframes_bookmarks",
+			version: 2,
+			init:    FrameInitInfo{PlayerName: "electronic", Position: [3]float32{0, -1024.5, 64}},
+			frames:  keyframes,
+			bookmarks: []Bookmark{
+				{Frame: 0, Name: "freezetime_end"},
+				{Frame: 129, Name: "first_shot"},
+				{Frame: 299, Name: "death"},
+			},
+		},
+		{
+			name:    "version1",
+			version: 1,
+			init:    FrameInitInfo{PlayerName: "legacy"},
+			frames:  keyframes[:130],
+			bookmarks: []Bookmark{
+				{Frame: 129, Name: "kill " + strings.Repeat("x", 80)},
+			},
+		},
+	}
+}
+
+func (c *goldenCase) recording() *Recording {
+	r := NewRecording(c.init)
+	r.Header.Version = c.version
+	r.Header.Timestamp = int32(fixedTime.Unix())
+	for _, frame := range c.frames {
+		r.AddFrame(frame)
+	}
+	for _, bookmark := range c.bookmarks {
+		r.AddBookmark(bookmark.Frame, bookmark.Name)
+	}
+	return r
+}
+
+func encode(t *testing.T, r *Recording) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("WriteTo 返回 %d 字节，实际写出 %d 字节", n, buf.Len())
+	}
+	return buf.Bytes()
+}
+
+func checkGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name+".rec")
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("读取 golden 文件失败 (使用 -update 生成): %v", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("编码结果与 %s 不一致: %d 字节, 期望 %d 字节", golden, len(data), len(want))
+	}
+}
+
+// expected 返回解码后应得到的录像：v1 没有 Origin，书签名截断为 63 字节
+func (c *goldenCase) expected() *Recording {
+	r := c.recording()
+	for idx := range r.Bookmarks {
+		if name := r.Bookmarks[idx].Name; len(name) > BOOKMARK_NAME_LENGTH-1 {
+			r.Bookmarks[idx].Name = name[:BOOKMARK_NAME_LENGTH-1]
+		}
+	}
+	if c.version == 1 {
+		for idx := range r.Frames {
+			r.Frames[idx].Origin = [3]float32{}
+		}
+	}
+	return r
+}
+
+func checkDecoded(t *testing.T, got, want *Recording) {
+	t.Helper()
+	if got.Header != want.Header {
+		t.Errorf("文件头 %+v, 期望 %+v", got.Header, want.Header)
+	}
+	if len(got.Bookmarks) != 0 || len(want.Bookmarks) != 0 {
+		if !reflect.DeepEqual(got.Bookmarks, want.Bookmarks) {
+			t.Errorf("书签 %+v, 期望 %+v", got.Bookmarks, want.Bookmarks)
+		}
+	}
+	if len(got.Frames) != len(want.Frames) {
+		t.Fatalf("帧数 %d, 期望 %d", len(got.Frames), len(want.Frames))
+	}
+	for idx := range got.Frames {
+		if got.Frames[idx] != want.Frames[idx] {
+			t.Fatalf("第 %d 帧 %+v, 期望 %+v", idx, got.Frames[idx], want.Frames[idx])
+		}
+	}
+}
+
+func TestGoldenRoundTrip(t *testing.T) {
+	for _, c := range goldenCases() {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			data := encode(t, c.recording())
+			if *update {
+				if err := ioutil.WriteFile(filepath.Join("testdata", c.name+".rec"), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkGolden(t, c.name, data)
+
+			decoded, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			checkDecoded(t, decoded, c.expected())
+
+			// 解码后重新编码应得到相同的字节
+			if again := encode(t, decoded); !bytes.Equal(again, data) {
+				t.Errorf("重新编码的结果与原始数据不一致")
+			}
+		})
+	}
+}
+
+func TestEncoderWriteToRecFile(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		for _, c := range goldenCases() {
+			dir := t.TempDir()
+			enc := NewEncoder(dir)
+			enc.SetClock(func() time.Time { return fixedTime })
+			enc.SetStreaming(streaming, t.TempDir())
+			if err := enc.SetFormatVersion(c.version); err != nil {
+				t.Fatal(err)
+			}
+			r := enc.InitPlayer(76561198034202275, c.init)
+			for _, frame := range c.frames {
+				r.AddFrame(frame)
+			}
+			for _, bookmark := range c.bookmarks {
+				r.AddBookmark(bookmark.Frame, bookmark.Name)
+			}
+
+			fileName, err := enc.WriteToRecFile(76561198034202275, 3, "ct")
+			if err != nil {
+				t.Fatalf("%s: WriteToRecFile: %v", c.name, err)
+			}
+			if want := filepath.Join(dir, "round3", "ct", c.init.PlayerName+".rec"); filepath.Clean(fileName) != want {
+				t.Errorf("%s: 文件路径 %s, 期望 %s", c.name, fileName, want)
+			}
+			entries, err := ioutil.ReadDir(filepath.Dir(fileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("%s: 输出目录中有 %d 个文件，临时文件没有清理", c.name, len(entries))
+			}
+			// 与直接创建的文件权限一致，不是临时文件的 0600
+			info, err := os.Stat(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := createdFileMode(t); info.Mode().Perm() != want {
+				t.Errorf("%s: 文件权限 %v, 期望 %v", c.name, info.Mode().Perm(), want)
+			}
+			data, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, c.name, data)
+			if enc.Recording(76561198034202275) != nil {
+				t.Errorf("%s: 保存后录像没有清理", c.name)
+			}
+		}
+	}
+}
+
+// createdFileMode 返回以 0644 创建的文件在当前 umask 下的权限
+func createdFileMode(t *testing.T) os.FileMode {
+	name := filepath.Join(t.TempDir(), "mode")
+	if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestDecodeErrors(t *testing.T) {
+	c := goldenCases()[1]
+	valid := encode(t, c.recording())
+
+	badMagic := append([]byte(nil), valid...)
+	badMagic[0] = 0
+	badVersion := append([]byte(nil), valid...)
+	badVersion[4] = 9
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"bad_magic", badMagic, ErrBadMagic},
+		{"bad_version", badVersion, ErrUnsupportedVersion},
+		{"empty", nil, ErrTruncated},
+		{"truncated_header", valid[:10], ErrTruncated},
+		{"truncated_frame", valid[:len(valid)-1], ErrTruncated},
+	}
+	for _, tt := range tests {
+		if _, err := Decode(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: 错误 %v, 期望 %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestEncodeLongName(t *testing.T) {
+	for _, name := range []string{strings.Repeat("中", 30), strings.Repeat("x", 300)} {
+		r := NewRecording(FrameInitInfo{PlayerName: name})
+		r.AddFrame(walkFrames(1)[0])
+		// 直接修改文件头的录像名也会在编码时截断
+		r.Header.Name = name
+		data := encode(t, r)
+
+		decoded, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if len(decoded.Header.Name) >= MAX_RECORD_NAME_LENGTH || !strings.HasPrefix(name, decoded.Header.Name) {
+			t.Errorf("录像名 %q 没有正确截断", decoded.Header.Name)
+		}
+		if !utf8.ValidString(decoded.Header.Name) {
+			t.Errorf("录像名 %q 在 UTF-8 字符中间截断", decoded.Header.Name)
+		}
+		if report := Validate(data, ValidateOptions{}); !report.Valid {
+			t.Errorf("截断后的录像没有通过检查: %+v", report.Issues)
+		}
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"a/b:c":   "a_b_c",
+		" ..":     "player",
+		"CON":     "_CON",
+		"nul.txt": "_nul.txt",
+		"Com1":    "_Com1",
+		"COM10":   "COM10",
+		"console": "console",
+	}
+	for name, want := range tests {
+		if got := SanitizeFileName(name); got != want {
+			t.Errorf("SanitizeFileName(%q) = %q, 期望 %q", name, got, want)
+		}
+	}
+}
+
+func TestRecFilePathIgnoresCase(t *testing.T) {
+	enc := NewEncoder(t.TempDir())
+	first := enc.recFilePath("ct", 1, "Player")
+	second := enc.recFilePath("ct", 2, "player")
+	if strings.EqualFold(first, second) {
+		t.Errorf("只有大小写不同的玩家名使用了同一个文件 %s / %s", first, second)
+	}
+	if again := enc.recFilePath("ct", 1, "Player"); again != first {
+		t.Errorf("同一玩家的文件路径 %s, 期望 %s", again, first)
+	}
+}
+
+func TestWriteToRecFileClampsBookmarks(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		enc := NewEncoder(t.TempDir())
+		enc.SetStreaming(streaming, t.TempDir())
+		r := enc.InitPlayer(1, FrameInitInfo{PlayerName: "defuser"})
+		frames := walkFrames(200)
+		for _, frame := range frames {
+			r.AddFrame(frame)
+		}
+		// 回合结束的事件在最后一帧录制之前分发，书签位于下一帧
+		r.AddBookmark(int32(r.FrameCount()), "bomb_defuse")
+		fileName, err := enc.WriteToRecFile(1, 1, "ct")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := Validate(data, ValidateOptions{}); !report.Valid || len(report.Issues) != 0 {
+			t.Errorf("streaming=%v: 录像没有通过检查: %+v", streaming, report.Issues)
+		}
+		decoded, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decoded.Bookmarks[0].Frame; int(got) != len(frames)-1 {
+			t.Errorf("streaming=%v: 书签位于第 %d 帧，期望最后一帧 %d", streaming, got, len(frames)-1)
+		}
+	}
+}
+
+func TestEncoderStreamError(t *testing.T) {
+	dir := t.TempDir()
+	enc := NewEncoder(dir)
+	enc.SetStreaming(true, filepath.Join(dir, "missing"))
+	r := enc.InitPlayer(1, FrameInitInfo{PlayerName: "memory"})
+	if enc.StreamError() == nil {
+		t.Fatal("临时文件目录不存在时没有返回错误")
+	}
+	if r.Streaming() {
+		t.Error("无法创建临时文件时应退回到内存中保存")
+	}
+	for _, frame := range walkFrames(100) {
+		r.AddFrame(frame)
+	}
+	if _, err := enc.WriteToRecFile(1, 1, "t"); err != nil {
+		t.Fatalf("WriteToRecFile: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package rec
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBadMagic           = errors.New("rec: 魔数错误")
+	ErrUnsupportedVersion = errors.New("rec: 不支持的格式版本")
+	ErrTruncated          = errors.New("rec: 文件不完整")
+	ErrNoRecording        = errors.New("rec: 玩家没有录像数据")
+)
+
+// MagicError 文件头魔数与 BotMimic 不一致
+type MagicError struct {
+	Magic int32
+}
+
+func (e *MagicError) Error() string {
+	return fmt.Sprintf("%s: 0x%08x", ErrBadMagic.Error(), uint32(e.Magic))
+}
+
+func (e *MagicError) Unwrap() error { return ErrBadMagic }
+
+// VersionError 格式版本无法解析
+type VersionError struct {
+	Version int8
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s: %d", ErrUnsupportedVersion.Error(), e.Version)
+}
+
+func (e *VersionError) Unwrap() error { return ErrUnsupportedVersion }
+
+// TruncatedError 文件在读取 Section 时提前结束
+type TruncatedError struct {
+	Section string
+	Err     error
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%s: 读取 %s 失败: %s", ErrTruncated.Error(), e.Section, e.Err.Error())
+}
+
+func (e *TruncatedError) Is(target error) bool { return target == ErrTruncated }
+
+func (e *TruncatedError) Unwrap() error { return e.Err }
+
+// NoRecordingError 保存录像时玩家没有初始化过录像
+type NoRecordingError struct {
+	SteamID uint64
+}
+
+func (e *NoRecordingError) Error() string {
+	return fmt.Sprintf("%s: %d", ErrNoRecording.Error(), e.SteamID)
+}
+
+func (e *NoRecordingError) Unwrap() error { return ErrNoRecording }
+
+// WriteError 写出录像文件失败
+type WriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("rec: 写入 %s 失败: %s", e.Path, e.Err.Error())
+}
+
+func (e *WriteError) Unwrap() error { return e.Err }
@@ -0,0 +1,156 @@
+package rec
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// Format 某个 BotMimic 格式版本的帧布局。
+// 文件头与书签在各版本中相同，只有帧的字段不同；新版本实现该接口并调用 RegisterFormat 即可。
+type Format interface {
+	Version() int8
+	// WriteFrame 按该版本的布局写出一帧
+	WriteFrame(w io.Writer, frame *FrameInfo) error
+	// ReadFrame 按该版本的布局读取一帧，文件中没有的字段保持零值
+	ReadFrame(r io.Reader, frame *FrameInfo) error
+}
+
+var formats = make(map[int8]Format)
+
+// RegisterFormat 注册格式版本，同一版本重复注册时覆盖之前的实现
+func RegisterFormat(format Format) {
+	formats[format.Version()] = format
+}
+
+// LookupFormat 返回 version 对应的格式
+func LookupFormat(version int8) (Format, bool) {
+	format, ok := formats[version]
+	return format, ok
+}
+
+// SupportedVersions 返回所有已注册的格式版本，从小到大排列
+func SupportedVersions() []int8 {
+	versions := make([]int8, 0, len(formats))
+	for version := range formats {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+func init() {
+	RegisterFormat(formatV1{})
+	RegisterFormat(formatV2{})
+}
+
+func writeFields(w io.Writer, fields ...interface{}) error {
+	for _, field := range fields {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFields(r io.Reader, fields ...interface{}) error {
+	for _, field := range fields {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAdditional 写出 AdditionalFields 标记的附加信息
+func writeAdditional(w io.Writer, frame *FrameInfo) error {
+	if frame.AdditionalFields&FIELDS_ORIGIN != 0 {
+		if err := writeFields(w, frame.AtOrigin); err != nil {
+			return err
+		}
+	}
+	if frame.AdditionalFields&FIELDS_ANGLES != 0 {
+		if err := writeFields(w, frame.AtAngles); err != nil {
+			return err
+		}
+	}
+	if frame.AdditionalFields&FIELDS_VELOCITY != 0 {
+		if err := writeFields(w, frame.AtVelocity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readAdditional(r io.Reader, frame *FrameInfo) error {
+	if frame.AdditionalFields&FIELDS_ORIGIN != 0 {
+		if err := readFields(r, &frame.AtOrigin); err != nil {
+			return err
+		}
+	}
+	if frame.AdditionalFields&FIELDS_ANGLES != 0 {
+		if err := readFields(r, &frame.AtAngles); err != nil {
+			return err
+		}
+	}
+	if frame.AdditionalFields&FIELDS_VELOCITY != 0 {
+		if err := readFields(r, &frame.AtVelocity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatV1 旧版 BotMimic，帧中没有 Origin
+type formatV1 struct{}
+
+func (formatV1) Version() int8 { return 1 }
+
+func (formatV1) WriteFrame(w io.Writer, frame *FrameInfo) error {
+	err := writeFields(w,
+		frame.PlayerButtons, frame.PlayerImpulse,
+		frame.ActualVelocity, frame.PredictedVelocity, frame.PredictedAngles,
+		frame.CSWeaponID, frame.PlayerSubtype, frame.PlayerSeed, frame.AdditionalFields)
+	if err != nil {
+		return err
+	}
+	return writeAdditional(w, frame)
+}
+
+func (formatV1) ReadFrame(r io.Reader, frame *FrameInfo) error {
+	err := readFields(r,
+		&frame.PlayerButtons, &frame.PlayerImpulse,
+		&frame.ActualVelocity, &frame.PredictedVelocity, &frame.PredictedAngles,
+		&frame.CSWeaponID, &frame.PlayerSubtype, &frame.PlayerSeed, &frame.AdditionalFields)
+	if err != nil {
+		return err
+	}
+	return readAdditional(r, frame)
+}
+
+// formatV2 在 PredictedAngles 之后增加了每帧的 Origin
+type formatV2 struct{}
+
+func (formatV2) Version() int8 { return 2 }
+
+func (formatV2) WriteFrame(w io.Writer, frame *FrameInfo) error {
+	err := writeFields(w,
+		frame.PlayerButtons, frame.PlayerImpulse,
+		frame.ActualVelocity, frame.PredictedVelocity, frame.PredictedAngles, frame.Origin,
+		frame.CSWeaponID, frame.PlayerSubtype, frame.PlayerSeed, frame.AdditionalFields)
+	if err != nil {
+		return err
+	}
+	return writeAdditional(w, frame)
+}
+
+func (formatV2) ReadFrame(r io.Reader, frame *FrameInfo) error {
+	err := readFields(r,
+		&frame.PlayerButtons, &frame.PlayerImpulse,
+		&frame.ActualVelocity, &frame.PredictedVelocity, &frame.PredictedAngles, &frame.Origin,
+		&frame.CSWeaponID, &frame.PlayerSubtype, &frame.PlayerSeed, &frame.AdditionalFields)
+	if err != nil {
+		return err
+	}
+	return readAdditional(r, frame)
+}
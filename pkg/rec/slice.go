@@ -0,0 +1,85 @@
+package rec
+
+// Slice 返回 [start, end) 帧组成的新录像。
+// 文件头的初始位置与视角取自第一帧，第一帧强制为完整关键帧 (位置、视角、速度) 并带上当前武器，
+// 区间内的书签保留并重新计算帧号与关键帧数量。
+// 流式写出的录像只能截取仍在内存中的帧，帧号同样从录像开始计数。
+// v1 格式的帧没有 Origin，start 不是位置关键帧时向前移动到最近的位置关键帧。
+func (r *Recording) Slice(start, end int) *Recording {
+	// 帧号与书签的帧号从录像开始计数，Frames 中的序号需要扣除已写入临时文件的帧
+	offset := 0
+	if r.spool != nil {
+		offset = r.spool.frames
+	}
+	start -= offset
+	end -= offset
+	if start < 0 {
+		start = 0
+	}
+	if end > len(r.Frames) {
+		end = len(r.Frames)
+	}
+	if end < start {
+		end = start
+	}
+	useHeader := false
+	if r.Header.Version == 1 && start < end {
+		for start > 0 && r.Frames[start].AdditionalFields&FIELDS_ORIGIN == 0 {
+			start--
+		}
+		// 没有更早的位置关键帧时从录像开始截取，位置取文件头中的初始位置
+		useHeader = r.spool == nil && r.Frames[start].AdditionalFields&FIELDS_ORIGIN == 0
+	}
+
+	clip := &Recording{
+		Header: r.Header,
+		Frames: append([]FrameInfo(nil), r.Frames[start:end]...),
+	}
+	if len(clip.Frames) == 0 {
+		return clip
+	}
+
+	// 已经是关键帧的字段保留原值，v1 格式的帧没有 Origin，只能依靠关键帧中的位置
+	first := &clip.Frames[0]
+	if useHeader {
+		first.AtOrigin = r.Header.Position
+	} else if first.AdditionalFields&FIELDS_ORIGIN == 0 {
+		first.AtOrigin = first.Origin
+	}
+	if first.AdditionalFields&FIELDS_ANGLES == 0 {
+		first.AtAngles = frameAngles(first)
+	}
+	if first.AdditionalFields&FIELDS_VELOCITY == 0 {
+		first.AtVelocity = first.ActualVelocity
+	}
+	first.AdditionalFields |= FIELDS_ORIGIN | FIELDS_ANGLES | FIELDS_VELOCITY
+	clip.Header.Position = first.AtOrigin
+	clip.Header.Angles = first.PredictedAngles
+	// 武器只在切换时记录，需要找回片段开始时手持的武器
+	if first.CSWeaponID == 0 {
+		for idx := start - 1; idx >= 0; idx-- {
+			if r.Frames[idx].CSWeaponID != 0 {
+				first.CSWeaponID = r.Frames[idx].CSWeaponID
+				break
+			}
+		}
+	}
+
+	for _, bookmark := range r.Bookmarks {
+		frame := int(bookmark.Frame) - offset
+		if frame < start || frame >= end {
+			continue
+		}
+		clip.AddBookmark(int32(frame-start), bookmark.Name)
+	}
+	return clip
+}
+
+// frameAngles 返回关键帧使用的视角 (pitch, yaw, roll)，pitch 转换到 [-180, 180)
+func frameAngles(frame *FrameInfo) [3]float32 {
+	pitch := frame.PredictedAngles[0]
+	if pitch >= 180 {
+		pitch -= 360
+	}
+	return [3]float32{pitch, frame.PredictedAngles[1], 0}
+}
@@ -0,0 +1,62 @@
+package rec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSliceVersion1(t *testing.T) {
+	c := goldenCases()[3]
+	decoded, err := Decode(bytes.NewReader(encode(t, c.recording())))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	// v1 的帧没有 Origin，起点需要移动到之前最近的位置关键帧 (第 0 帧)
+	clip := decoded.Slice(5, 10)
+	if len(clip.Frames) != 10 {
+		t.Fatalf("片段有 %d 帧，期望 10 帧", len(clip.Frames))
+	}
+	want := c.frames[0].Origin
+	if clip.Header.Position != want || clip.Frames[0].AtOrigin != want {
+		t.Errorf("初始位置 %v / %v，期望 %v", clip.Header.Position, clip.Frames[0].AtOrigin, want)
+	}
+
+	// 起点之前没有位置关键帧时使用文件头中的初始位置
+	r := NewRecording(FrameInitInfo{PlayerName: "legacy", Position: [3]float32{1, 2, 3}})
+	r.Header.Version = 1
+	for _, frame := range walkFrames(20) {
+		r.AddFrame(frame)
+	}
+	decoded, err = Decode(bytes.NewReader(encode(t, r)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if clip := decoded.Slice(5, 10); clip.Header.Position != r.Header.Position {
+		t.Errorf("初始位置 %v，期望 %v", clip.Header.Position, r.Header.Position)
+	}
+}
+
+func TestSliceStreamingBookmarks(t *testing.T) {
+	r := NewRecording(FrameInitInfo{PlayerName: "stream"})
+	if err := r.Stream(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, frame := range walkFrames(300) {
+		r.AddFrame(frame)
+	}
+	if len(r.Frames) == r.FrameCount() {
+		t.Fatal("没有帧写入临时文件")
+	}
+
+	start := r.FrameCount() - 20
+	r.AddBookmark(int32(start+5), "first_shot")
+	clip := r.Slice(start, start+10)
+	if len(clip.Bookmarks) != 1 || clip.Bookmarks[0].Frame != 5 {
+		t.Errorf("书签 %+v，期望位于第 5 帧", clip.Bookmarks)
+	}
+	if want := r.Frame(start).Origin; clip.Header.Position != want {
+		t.Errorf("初始位置 %v，期望 %v", clip.Header.Position, want)
+	}
+}
@@ -0,0 +1,153 @@
+package rec
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// 流式写出时内存中保留的最少帧数，解析器需要修改最近几帧的移动输入
+const streamWindow = 64
+
+// spool 流式写出时暂存已编码帧的临时文件。
+// BotMimic 格式中书签位于帧数据之前，所以帧先写入临时文件，保存时再接在文件头与书签之后。
+type spool struct {
+	file *os.File
+	w    *bufio.Writer
+	// 已写入临时文件的帧数与其中关键帧的序号，用于计算书签的 AdditionalTeleportTick
+	frames    int
+	keyframes []int
+}
+
+// Stream 将录像改为流式写出：超出 streamWindow 的旧帧编码后写入 dir 下的临时文件，
+// Frames 中只保留最近的帧。dir 为空时使用系统临时目录。
+func (r *Recording) Stream(dir string) error {
+	if r.spool != nil {
+		return nil
+	}
+	file, err := os.CreateTemp(dir, "minidemo-*.frames")
+	if err != nil {
+		return err
+	}
+	r.spool = &spool{file: file, w: bufio.NewWriter(file)}
+	return nil
+}
+
+// Streaming 返回录像是否流式写出
+func (r *Recording) Streaming() bool {
+	return r.spool != nil
+}
+
+// FrameCount 返回录像的总帧数，包括已经写入临时文件的帧
+func (r *Recording) FrameCount() int {
+	if r.spool == nil {
+		return len(r.Frames)
+	}
+	return r.spool.frames + len(r.Frames)
+}
+
+// Frame 返回第 idx 帧 (从录像开始计数)，该帧已经写入临时文件时返回 nil
+func (r *Recording) Frame(idx int) *FrameInfo {
+	if r.spool != nil {
+		idx -= r.spool.frames
+	}
+	if idx < 0 || idx >= len(r.Frames) {
+		return nil
+	}
+	return &r.Frames[idx]
+}
+
+// flush 将 Frames 中除最后 keep 帧以外的帧写入临时文件
+func (r *Recording) flush(keep int) {
+	n := len(r.Frames) - keep
+	if r.spool == nil || r.err != nil || n <= 0 {
+		return
+	}
+	format, ok := LookupFormat(r.Header.Version)
+	if !ok {
+		r.err = &VersionError{Version: r.Header.Version}
+		return
+	}
+	for idx := 0; idx < n; idx++ {
+		if err := format.WriteFrame(r.spool.w, &r.Frames[idx]); err != nil {
+			r.err = err
+			return
+		}
+		if r.Frames[idx].AdditionalFields != 0 {
+			r.spool.keyframes = append(r.spool.keyframes, r.spool.frames+idx)
+		}
+	}
+	r.spool.frames += n
+	r.Frames = append(r.Frames[:0], r.Frames[n:]...)
+}
+
+// copySpool 将临时文件中的帧复制到 w
+func (r *Recording) copySpool(w io.Writer) (int64, error) {
+	if err := r.spool.w.Flush(); err != nil {
+		return 0, err
+	}
+	if _, err := r.spool.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, r.spool.file)
+	if err != nil {
+		return n, err
+	}
+	// 继续追加帧时写在文件末尾
+	_, err = r.spool.file.Seek(0, io.SeekEnd)
+	return n, err
+}
+
+// Close 删除流式写出的临时文件，录像不再使用时调用
+func (r *Recording) Close() error {
+	if r.spool == nil {
+		return nil
+	}
+	name := r.spool.file.Name()
+	err := r.spool.file.Close()
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	r.spool = nil
+	return err
+}
+
+// WriteFile 将录像写入 path，目录需要已经存在。
+// 先写入同目录下的临时文件再重命名，输出目录中不会出现写了一半的文件。
+func (r *Recording) WriteFile(path string) error {
+	file, err := createTemp(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return &WriteError{Path: path, Err: err}
+	}
+	if _, err := r.WriteTo(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return &WriteError{Path: path, Err: err}
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return &WriteError{Path: path, Err: err}
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return &WriteError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// createTemp 在 dir 中创建 <prefix><随机数>.tmp 临时文件。
+// os.CreateTemp 创建的文件权限为 0600，重命名后其他用户 (例如游戏服务器) 无法读取，
+// 这里与直接创建文件一样使用 0644 (受 umask 影响)。
+func createTemp(dir, prefix string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return file, err
+	}
+}
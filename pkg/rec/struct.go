@@ -0,0 +1,57 @@
+package rec
+
+import "bytes"
+
+type FrameInitInfo struct {
+	PlayerName string
+	Position   [3]float32
+	Angles     [2]float32
+}
+
+// replay frame
+type FrameInfo struct {
+	PlayerButtons     int32
+	PlayerImpulse     int32
+	ActualVelocity    [3]float32
+	PredictedVelocity [3]float32
+	PredictedAngles   [2]float32
+	Origin            [3]float32
+	CSWeaponID        int32
+	PlayerSubtype     int32
+	PlayerSeed        int32
+	AdditionalFields  int32
+	// 附加信息
+	AtOrigin   [3]float32
+	AtAngles   [3]float32
+	AtVelocity [3]float32
+}
+
+// Header .rec 文件头
+type Header struct {
+	Magic     int32
+	Version   int8
+	Timestamp int32
+	Name      string
+	Position  [3]float32
+	Angles    [2]float32
+}
+
+// Bookmark BotMimic 书签
+type Bookmark struct {
+	Frame                  int32  `json:"frame"`
+	AdditionalTeleportTick int32  `json:"additional_teleport_tick"`
+	Name                   string `json:"name"`
+}
+
+// Recording 单个玩家的录像，持有自己的帧数据与编码缓冲区
+type Recording struct {
+	Header    Header
+	Bookmarks []Bookmark
+	// 流式写出时只包含最近的帧，见 Stream
+	Frames []FrameInfo
+
+	buf   bytes.Buffer
+	spool *spool
+	// 流式写出临时文件时的第一个错误
+	err error
+}
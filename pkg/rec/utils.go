@@ -0,0 +1,59 @@
+package rec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf8"
+)
+
+func writeToBuf(buf *bytes.Buffer, data interface{}) {
+	binary.Write(buf, binary.LittleEndian, data)
+}
+
+// truncateName 将录像名截断到 MAX_RECORD_NAME_LENGTH-1 字节以内，不截断 UTF-8 字符
+func truncateName(name string) string {
+	if len(name) < MAX_RECORD_NAME_LENGTH {
+		return name
+	}
+	end := MAX_RECORD_NAME_LENGTH - 1
+	for end > 0 && !utf8.RuneStart(name[end]) {
+		end--
+	}
+	return name[:end]
+}
+
+// SanitizeFileName 将玩家名转换为可安全用作文件名的字符串
+func SanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return '_'
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	// Windows 不允许文件名以空格或点结尾，"." 与 ".." 也不能作为文件名
+	name = strings.Trim(name, " .")
+	if name == "" {
+		name = "player"
+	}
+	// Windows 的设备名 (CON、NUL、COM1 等) 不论大小写与扩展名都不能作为文件名
+	stem := name
+	if idx := strings.IndexByte(stem, '.'); idx >= 0 {
+		stem = stem[:idx]
+	}
+	if reservedFileNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = "_" + name
+	}
+	return name
+}
+
+var reservedFileNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
@@ -0,0 +1,163 @@
+package rec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 录像名的最大长度，对应 BotMimic 的 MAX_RECORD_NAME_LENGTH (含 \0)
+const MAX_RECORD_NAME_LENGTH = 64
+
+// sv_maxvelocity，相邻两帧的位移超过该速度对应的距离时视为传送
+const MAX_VELOCITY = 3500.0
+
+// 每项检查最多记录的问题数，其余只计数
+const maxIssuesPerCheck = 20
+
+// 检查项
+const (
+	CHECK_MAGIC    = "magic"
+	CHECK_VERSION  = "version"
+	CHECK_NAME     = "name"
+	CHECK_FORMAT   = "format"
+	CHECK_BOOKMARK = "bookmark"
+	CHECK_FIELDS   = "fields"
+	CHECK_FLOAT    = "float"
+	CHECK_WEAPON   = "weapon"
+	CHECK_TELEPORT = "teleport"
+	CHECK_TRAILING = "trailing"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+// ValidateOptions 校验时使用的参数
+type ValidateOptions struct {
+	// 录像的 tickrate，用于判断传送式位移
+	TickRate float64
+	// 判断武器 ID 是否合法，为空时不检查
+	ValidWeapon func(weaponID int32) bool
+}
+
+// Issue 校验发现的单个问题，Frame 为 nil 时表示与具体帧无关
+type Issue struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Frame    *int   `json:"frame,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport 单个文件的校验结果，存在 error 级别的问题时 Valid 为 false
+type ValidationReport struct {
+	File      string         `json:"file"`
+	Valid     bool           `json:"valid"`
+	TickCount int            `json:"tick_count"`
+	Issues    []Issue        `json:"issues"`
+	Counts    map[string]int `json:"counts"`
+}
+
+func (report *ValidationReport) add(severity, check string, frame int, format string, args ...interface{}) {
+	if severity == SEVERITY_ERROR {
+		report.Valid = false
+	}
+	report.Counts[check]++
+	if report.Counts[check] > maxIssuesPerCheck {
+		return
+	}
+	issue := Issue{Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)}
+	if frame >= 0 {
+		issue.Frame = &frame
+	}
+	report.Issues = append(report.Issues, issue)
+}
+
+func finite(values ...float32) bool {
+	for _, v := range values {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate 解码 data 并检查其是否能被 BotMimic 正确读取
+func Validate(data []byte, opts ValidateOptions) *ValidationReport {
+	report := &ValidationReport{Valid: true, Issues: []Issue{}, Counts: make(map[string]int)}
+
+	reader := bytes.NewReader(data)
+	r, err := Decode(reader)
+	if err != nil {
+		var truncated *TruncatedError
+		switch {
+		case errors.Is(err, ErrBadMagic):
+			report.add(SEVERITY_ERROR, CHECK_MAGIC, -1, "%s", err.Error())
+		case errors.Is(err, ErrUnsupportedVersion):
+			report.add(SEVERITY_ERROR, CHECK_VERSION, -1, "%s", err.Error())
+		case errors.As(err, &truncated):
+			report.add(SEVERITY_ERROR, CHECK_FORMAT, -1, "帧数或书签数与文件内容不符: %s", err.Error())
+		default:
+			report.add(SEVERITY_ERROR, CHECK_FORMAT, -1, "%s", err.Error())
+		}
+		return report
+	}
+	report.TickCount = len(r.Frames)
+	if trailing := reader.Len(); trailing > 0 {
+		report.add(SEVERITY_ERROR, CHECK_TRAILING, -1, "帧数据之后还有 %d 字节", trailing)
+	}
+
+	if len(r.Header.Name) >= MAX_RECORD_NAME_LENGTH {
+		report.add(SEVERITY_ERROR, CHECK_NAME, -1, "录像名长度 %d 超过 %d", len(r.Header.Name), MAX_RECORD_NAME_LENGTH-1)
+	}
+	if !finite(r.Header.Position[:]...) || !finite(r.Header.Angles[:]...) {
+		report.add(SEVERITY_ERROR, CHECK_FLOAT, -1, "初始位置或视角包含 NaN/Inf")
+	}
+
+	// 每一帧之前的关键帧数量，用于检查书签的 AdditionalTeleportTick
+	teleports := make([]int32, len(r.Frames)+1)
+	for idx := range r.Frames {
+		teleports[idx+1] = teleports[idx]
+		if r.Frames[idx].AdditionalFields != 0 {
+			teleports[idx+1]++
+		}
+	}
+	for _, bookmark := range r.Bookmarks {
+		if bookmark.Frame < 0 || int(bookmark.Frame) >= len(r.Frames) {
+			report.add(SEVERITY_ERROR, CHECK_BOOKMARK, -1, "书签 %q 的帧 %d 超出范围 [0, %d)", bookmark.Name, bookmark.Frame, len(r.Frames))
+			continue
+		}
+		if expected := teleports[bookmark.Frame]; bookmark.AdditionalTeleportTick != expected {
+			report.add(SEVERITY_WARNING, CHECK_BOOKMARK, int(bookmark.Frame), "书签 %q 的关键帧数为 %d，应为 %d", bookmark.Name, bookmark.AdditionalTeleportTick, expected)
+		}
+	}
+
+	knownFields := FIELDS_ORIGIN | FIELDS_ANGLES | FIELDS_VELOCITY
+	for idx := range r.Frames {
+		frame := &r.Frames[idx]
+		if frame.AdditionalFields&^knownFields != 0 {
+			report.add(SEVERITY_ERROR, CHECK_FIELDS, idx, "未知的附加字段 0x%x", frame.AdditionalFields&^knownFields)
+		}
+		if !finite(frame.ActualVelocity[:]...) || !finite(frame.PredictedVelocity[:]...) ||
+			!finite(frame.PredictedAngles[:]...) || !finite(frame.Origin[:]...) ||
+			!finite(frame.AtOrigin[:]...) || !finite(frame.AtAngles[:]...) || !finite(frame.AtVelocity[:]...) {
+			report.add(SEVERITY_ERROR, CHECK_FLOAT, idx, "帧数据包含 NaN/Inf")
+		}
+		if opts.ValidWeapon != nil && frame.CSWeaponID != 0 && !opts.ValidWeapon(frame.CSWeaponID) {
+			report.add(SEVERITY_ERROR, CHECK_WEAPON, idx, "未知的武器 ID %d", frame.CSWeaponID)
+		}
+		// 关键帧会同步位置，其余帧出现大幅位移时回放的 bot 无法跟上
+		if idx > 0 && opts.TickRate > 0 && frame.AdditionalFields&FIELDS_ORIGIN == 0 {
+			prev := &r.Frames[idx-1]
+			dx := float64(frame.Origin[0] - prev.Origin[0])
+			dy := float64(frame.Origin[1] - prev.Origin[1])
+			dz := float64(frame.Origin[2] - prev.Origin[2])
+			if dist := math.Sqrt(dx*dx + dy*dy + dz*dz); dist > MAX_VELOCITY/opts.TickRate {
+				report.add(SEVERITY_WARNING, CHECK_TELEPORT, idx, "位移 %.1f 超过单帧最大距离 %.1f 且不是关键帧", dist, MAX_VELOCITY/opts.TickRate)
+			}
+		}
+	}
+	return report
+}